@@ -4,9 +4,11 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/kerimovkk/pow-server/internal/client"
+	"github.com/kerimovkk/pow-server/internal/protocol"
 )
 
 func main() {
@@ -14,12 +16,23 @@ func main() {
 	serverAddr := flag.String("server", "localhost:8080", "Server address (host:port)")
 	timeout := flag.Duration("timeout", 30*time.Second, "Connection timeout")
 	count := flag.Int("count", 1, "Number of quotes to request")
+	encrypt := flag.Bool("encrypt", false, "Request the encrypted-channel option for the returned quote")
+	trace := flag.Bool("trace", false, "Dump every protocol frame sent/received to stderr")
 	flag.Parse()
 
+	if *trace {
+		protocol.SetTracer(os.Stderr)
+	}
+
 	log.Printf("Connecting to server at %s...", *serverAddr)
 
 	// Create client
-	c := client.NewClient(*serverAddr, *timeout)
+	var c *client.Client
+	if *encrypt {
+		c = client.NewEncryptedClient(*serverAddr, *timeout)
+	} else {
+		c = client.NewClient(*serverAddr, *timeout)
+	}
 
 	// Request quotes
 	successCount := 0
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/kerimovkk/pow-server/internal/pow"
+	"github.com/kerimovkk/pow-server/internal/protocol"
 	"github.com/kerimovkk/pow-server/internal/quotes"
 	"github.com/kerimovkk/pow-server/internal/server"
 	"gopkg.in/yaml.v3"
@@ -21,17 +24,37 @@ type Config struct {
 		ReadTimeout       time.Duration `yaml:"read_timeout"`
 		WriteTimeout      time.Duration `yaml:"write_timeout"`
 		ConnectionTimeout time.Duration `yaml:"connection_timeout"`
+		Workers           int           `yaml:"workers"`
+		QueueSize         int           `yaml:"queue_size"`
+		AdminAddr         string        `yaml:"admin_addr"`
 	} `yaml:"server"`
 	PoW struct {
 		BaseDifficulty    int           `yaml:"base_difficulty"`
 		MaxDifficulty     int           `yaml:"max_difficulty"`
 		ChallengeMaxAge   time.Duration `yaml:"challenge_max_age"`
 		DynamicAdjustment bool          `yaml:"dynamic_adjustment"`
+		Algorithm         string        `yaml:"algorithm"`
+		// TargetRate and HalfLife tune the dynamic difficulty controller;
+		// see server.Config.DifficultyTargetRate/DifficultyHalfLife for
+		// their defaults when left unset.
+		TargetRate float64       `yaml:"target_rate"`
+		HalfLife   time.Duration `yaml:"half_life"`
 	} `yaml:"pow"`
+	HMAC struct {
+		// Key signs the stateless challenge tokens handed out to clients.
+		// Required for multi-instance deployments behind a load balancer,
+		// since each instance otherwise generates its own ephemeral key
+		// and rejects tokens issued by its siblings.
+		Key             string `yaml:"key"`
+		MaxPreviousKeys int    `yaml:"max_previous_keys"`
+	} `yaml:"hmac"`
 	RateLimit struct {
 		MaxRequests     int           `yaml:"max_requests"`
 		Window          time.Duration `yaml:"window"`
 		CleanupInterval time.Duration `yaml:"cleanup_interval"`
+		// Mode selects the RateLimiter implementation: "token-bucket"
+		// (default) or "sliding-window".
+		Mode string `yaml:"mode"`
 	} `yaml:"rate_limit"`
 	Quotes struct {
 		FilePath string `yaml:"file_path"`
@@ -39,6 +62,13 @@ type Config struct {
 }
 
 func main() {
+	trace := flag.Bool("trace", false, "Dump every protocol frame sent/received to stderr")
+	flag.Parse()
+
+	if *trace {
+		protocol.SetTracer(os.Stderr)
+	}
+
 	log.Println("Starting Word of Wisdom server...")
 
 	// Load configuration
@@ -54,24 +84,45 @@ func main() {
 	}
 	log.Printf("Loaded %d quotes", quotesManager.Count())
 
+	powAlgorithm, err := pow.ParseAlgorithmID(cfg.PoW.Algorithm)
+	if err != nil {
+		log.Fatalf("Invalid pow.algorithm: %v", err)
+	}
+
+	rateLimiterMode, err := server.ParseRateLimiterMode(cfg.RateLimit.Mode)
+	if err != nil {
+		log.Fatalf("Invalid rate_limit.mode: %v", err)
+	}
+
 	// Create rate limiter
-	rateLimiter := server.NewRateLimiter(
+	rateLimiter := server.NewRateLimiterWithMode(
 		cfg.RateLimit.MaxRequests,
 		cfg.RateLimit.Window,
 		cfg.RateLimit.CleanupInterval,
+		rateLimiterMode,
 	)
 	defer rateLimiter.Stop()
 
 	// Create server config
 	serverConfig := &server.Config{
-		Host:               cfg.Server.Host,
-		Port:               cfg.Server.Port,
-		MaxConnections:     cfg.Server.MaxConnections,
-		ReadTimeout:        cfg.Server.ReadTimeout,
-		WriteTimeout:       cfg.Server.WriteTimeout,
-		ConnectionTimeout:  cfg.Server.ConnectionTimeout,
-		PoWDifficulty:      cfg.PoW.BaseDifficulty,
-		PoWChallengeMaxAge: cfg.PoW.ChallengeMaxAge,
+		Host:                 cfg.Server.Host,
+		Port:                 cfg.Server.Port,
+		MaxConnections:       cfg.Server.MaxConnections,
+		ReadTimeout:          cfg.Server.ReadTimeout,
+		WriteTimeout:         cfg.Server.WriteTimeout,
+		ConnectionTimeout:    cfg.Server.ConnectionTimeout,
+		PoWDifficulty:        cfg.PoW.BaseDifficulty,
+		PoWMaxDifficulty:     cfg.PoW.MaxDifficulty,
+		PoWChallengeMaxAge:   cfg.PoW.ChallengeMaxAge,
+		DynamicDifficulty:    cfg.PoW.DynamicAdjustment,
+		DifficultyTargetRate: cfg.PoW.TargetRate,
+		DifficultyHalfLife:   cfg.PoW.HalfLife,
+		Workers:              cfg.Server.Workers,
+		QueueSize:            cfg.Server.QueueSize,
+		AdminAddr:            cfg.Server.AdminAddr,
+		PoWAlgorithm:         powAlgorithm,
+		HMACKey:              []byte(cfg.HMAC.Key),
+		HMACMaxPreviousKeys:  cfg.HMAC.MaxPreviousKeys,
 	}
 
 	// Create and start server
@@ -14,6 +14,10 @@ import (
 type Client struct {
 	serverAddr string
 	timeout    time.Duration
+	// encryptPayloads requests that the server encrypt the Quote/Error
+	// payload it returns after verifying the solution (see
+	// protocol.DeriveEncryptionKey).
+	encryptPayloads bool
 }
 
 // NewClient creates a new client
@@ -24,6 +28,16 @@ func NewClient(serverAddr string, timeout time.Duration) *Client {
 	}
 }
 
+// NewEncryptedClient creates a new client that requests the encrypted
+// channel option for every request (see protocol.DeriveEncryptionKey).
+func NewEncryptedClient(serverAddr string, timeout time.Duration) *Client {
+	return &Client{
+		serverAddr:      serverAddr,
+		timeout:         timeout,
+		encryptPayloads: true,
+	}
+}
+
 // GetQuote connects to the server and retrieves a quote
 func (c *Client) GetQuote() (string, error) {
 	// Connect to server
@@ -36,20 +50,33 @@ func (c *Client) GetQuote() (string, error) {
 	// Set overall deadline
 	conn.SetDeadline(time.Now().Add(c.timeout))
 
+	// A single connection carries the whole handshake (request, response,
+	// solution, quote), so an Encoder/Decoder pair -- reusing one pooled
+	// buffer across all four frames -- saves the per-call pool round trips
+	// WriteMessage/ReadMessage would otherwise do.
+	enc := protocol.NewEncoder(conn)
+	defer enc.Close()
+	dec := protocol.NewDecoder(conn)
+	defer dec.Close()
+
 	// Send challenge request
 	log.Println("Sending challenge request...")
+	reqPayload, err := protocol.EncodeChallengeRequest(&protocol.ChallengeRequest{WantEncrypted: c.encryptPayloads})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode challenge request: %w", err)
+	}
 	msg := &protocol.Message{
 		Type:    protocol.MessageTypeChallengeRequest,
-		Payload: []byte{}, // Empty payload
+		Payload: reqPayload,
 	}
 
-	if err := protocol.WriteMessage(conn, msg); err != nil {
+	if err := enc.Encode(msg); err != nil {
 		return "", fmt.Errorf("failed to send challenge request: %w", err)
 	}
 
 	// Receive challenge response
 	log.Println("Waiting for challenge...")
-	msg, err = protocol.ReadMessage(conn)
+	msg, err = dec.Decode()
 	if err != nil {
 		return "", fmt.Errorf("failed to read challenge response: %w", err)
 	}
@@ -68,7 +95,12 @@ func (c *Client) GetQuote() (string, error) {
 		return "", fmt.Errorf("failed to decode challenge: %w", err)
 	}
 
-	log.Printf("Received challenge with difficulty: %d (IP: %s)", challengeResp.Difficulty, challengeResp.ClientIP)
+	algo, err := pow.ByID(pow.AlgorithmID(challengeResp.Algorithm))
+	if err != nil {
+		return "", fmt.Errorf("unsupported PoW algorithm: %w", err)
+	}
+
+	log.Printf("Received %s challenge with difficulty: %d (IP: %s)", algo.ID(), challengeResp.Difficulty, challengeResp.ClientIP)
 
 	// Solve the PoW challenge
 	log.Println("Solving PoW challenge...")
@@ -80,17 +112,18 @@ func (c *Client) GetQuote() (string, error) {
 	}
 
 	startTime := time.Now()
-	nonce, err := pow.Solve(challenge)
+	sol, err := algo.Solve(challenge)
 	if err != nil {
 		return "", fmt.Errorf("failed to solve challenge: %w", err)
 	}
 	solveTime := time.Since(startTime)
-	log.Printf("Challenge solved in %v (nonce: %d)", solveTime, nonce)
+	log.Printf("Challenge solved in %v (nonces: %v)", solveTime, sol.Nonces)
 
 	// Send solution
 	log.Println("Sending solution...")
 	solution := &protocol.Solution{
-		Nonce: nonce,
+		Token:  challengeResp.Token,
+		Nonces: sol.Nonces,
 	}
 
 	payload, err := protocol.EncodeSolution(solution)
@@ -103,30 +136,53 @@ func (c *Client) GetQuote() (string, error) {
 		Payload: payload,
 	}
 
-	if err := protocol.WriteMessage(conn, msg); err != nil {
+	if err := enc.Encode(msg); err != nil {
 		return "", fmt.Errorf("failed to send solution: %w", err)
 	}
 
 	// Receive quote or error
 	log.Println("Waiting for quote...")
-	msg, err = protocol.ReadMessage(conn)
+	msg, err = dec.Decode()
 	if err != nil {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	if msg.Type == protocol.MessageTypeError {
+	// Re-derive the encrypted channel's key from the nonce just solved --
+	// the same derivation the server performed once it verified the
+	// solution (see protocol.DeriveEncryptionKey).
+	var nonce uint64
+	if len(sol.Nonces) > 0 {
+		nonce = sol.Nonces[0]
+	}
+	encKey := protocol.DeriveEncryptionKey(challengeResp.RandomData, nonce, challengeResp.ClientIP)
+
+	switch msg.Type {
+	case protocol.MessageTypeError:
 		errMsg, _ := protocol.DecodeError(msg.Payload)
 		return "", fmt.Errorf("server error: %s", errMsg.Message)
-	}
 
-	if msg.Type != protocol.MessageTypeQuote {
-		return "", fmt.Errorf("unexpected message type: %d", msg.Type)
-	}
+	case protocol.MessageTypeErrorEncrypted:
+		errMsg, err := protocol.DecodeErrorEncrypted(msg.Payload, encKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt error: %w", err)
+		}
+		return "", fmt.Errorf("server error: %s", errMsg.Message)
 
-	quote, err := protocol.DecodeQuote(msg.Payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode quote: %w", err)
+	case protocol.MessageTypeQuote:
+		quote, err := protocol.DecodeQuote(msg.Payload)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode quote: %w", err)
+		}
+		return quote.Text, nil
+
+	case protocol.MessageTypeQuoteEncrypted:
+		quote, err := protocol.DecodeQuoteEncrypted(msg.Payload, encKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt quote: %w", err)
+		}
+		return quote.Text, nil
+
+	default:
+		return "", fmt.Errorf("unexpected message type: %d", msg.Type)
 	}
-
-	return quote.Text, nil
 }
\ No newline at end of file
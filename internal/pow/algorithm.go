@@ -0,0 +1,73 @@
+package pow
+
+import "fmt"
+
+// AlgorithmID identifies a PoW scheme on the wire.
+type AlgorithmID byte
+
+const (
+	// AlgorithmHashcashSHA256 is the original leading-zero-bits SHA-256 scheme.
+	AlgorithmHashcashSHA256 AlgorithmID = 0x01
+	// AlgorithmArgon2id is a memory-hard scheme built on Argon2id.
+	AlgorithmArgon2id AlgorithmID = 0x02
+	// AlgorithmEquihash is a simplified, Equihash-inspired multi-nonce scheme.
+	AlgorithmEquihash AlgorithmID = 0x03
+)
+
+// String returns the human-readable name used in config files and logs.
+func (id AlgorithmID) String() string {
+	switch id {
+	case AlgorithmHashcashSHA256:
+		return "hashcash-sha256"
+	case AlgorithmArgon2id:
+		return "argon2id"
+	case AlgorithmEquihash:
+		return "equihash"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(id))
+	}
+}
+
+// ParseAlgorithmID maps a config string to its AlgorithmID.
+func ParseAlgorithmID(name string) (AlgorithmID, error) {
+	switch name {
+	case "hashcash-sha256", "":
+		return AlgorithmHashcashSHA256, nil
+	case "argon2id":
+		return AlgorithmArgon2id, nil
+	case "equihash":
+		return AlgorithmEquihash, nil
+	default:
+		return 0, fmt.Errorf("unknown PoW algorithm: %q", name)
+	}
+}
+
+// Solution carries the nonce(s) a client found for a challenge. Hashcash
+// and Argon2id need exactly one; the Equihash-like scheme needs K distinct
+// nonces.
+type Solution struct {
+	Nonces []uint64
+}
+
+// Algorithm is a pluggable proof-of-work scheme. Verify must stay cheap
+// since it runs on the server's hot path for every connection; Solve is
+// expected to be expensive and runs once on the client.
+type Algorithm interface {
+	ID() AlgorithmID
+	Solve(c *Challenge) (Solution, error)
+	Verify(c *Challenge, sol Solution, clientIP string) bool
+}
+
+// ByID returns the Algorithm implementation for id.
+func ByID(id AlgorithmID) (Algorithm, error) {
+	switch id {
+	case AlgorithmHashcashSHA256:
+		return HashcashSHA256{}, nil
+	case AlgorithmArgon2id:
+		return Argon2id{}, nil
+	case AlgorithmEquihash:
+		return Equihash{}, nil
+	default:
+		return nil, fmt.Errorf("unknown algorithm id: %d", byte(id))
+	}
+}
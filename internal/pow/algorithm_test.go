@@ -0,0 +1,149 @@
+package pow
+
+import "testing"
+
+func TestByID(t *testing.T) {
+	tests := []struct {
+		id      AlgorithmID
+		wantErr bool
+	}{
+		{AlgorithmHashcashSHA256, false},
+		{AlgorithmArgon2id, false},
+		{AlgorithmEquihash, false},
+		{AlgorithmID(0xFF), true},
+	}
+
+	for _, tt := range tests {
+		algo, err := ByID(tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ByID(%v) error = %v, wantErr %v", tt.id, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && algo.ID() != tt.id {
+			t.Errorf("ByID(%v).ID() = %v, want %v", tt.id, algo.ID(), tt.id)
+		}
+	}
+}
+
+func TestParseAlgorithmID(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    AlgorithmID
+		wantErr bool
+	}{
+		{"hashcash-sha256", AlgorithmHashcashSHA256, false},
+		{"", AlgorithmHashcashSHA256, false},
+		{"argon2id", AlgorithmArgon2id, false},
+		{"equihash", AlgorithmEquihash, false},
+		{"bogus", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAlgorithmID(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAlgorithmID(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseAlgorithmID(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArgon2id_SolveAndVerify(t *testing.T) {
+	challenge, err := GenerateChallenge("127.0.0.1", 8)
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	algo := Argon2id{}
+	sol, err := algo.Solve(challenge)
+	if err != nil {
+		t.Fatalf("Solve failed: %v", err)
+	}
+
+	if !algo.Verify(challenge, sol, "127.0.0.1") {
+		t.Error("Verify returned false for a solution Solve just produced")
+	}
+	if algo.Verify(challenge, sol, "10.0.0.1") {
+		t.Error("Verify returned true for the wrong client IP")
+	}
+	if algo.Verify(challenge, Solution{Nonces: []uint64{sol.Nonces[0] + 1}}, "127.0.0.1") {
+		t.Error("Verify returned true for a nonce Solve did not produce")
+	}
+}
+
+func TestEquihash_SolveAndVerify(t *testing.T) {
+	challenge, err := GenerateChallenge("127.0.0.1", 8)
+	if err != nil {
+		t.Fatalf("GenerateChallenge failed: %v", err)
+	}
+
+	algo := Equihash{}
+	sol, err := algo.Solve(challenge)
+	if err != nil {
+		t.Fatalf("Solve failed: %v", err)
+	}
+	if len(sol.Nonces) != equihashK {
+		t.Fatalf("Solve returned %d nonces, want %d", len(sol.Nonces), equihashK)
+	}
+
+	if !algo.Verify(challenge, sol, "127.0.0.1") {
+		t.Error("Verify returned false for a solution Solve just produced")
+	}
+	if algo.Verify(challenge, sol, "10.0.0.1") {
+		t.Error("Verify returned true for the wrong client IP")
+	}
+
+	dup := Solution{Nonces: []uint64{sol.Nonces[0], sol.Nonces[0], sol.Nonces[0], sol.Nonces[0]}}
+	if algo.Verify(challenge, dup, "127.0.0.1") {
+		t.Error("Verify returned true for a solution with duplicate nonces")
+	}
+
+	short := Solution{Nonces: sol.Nonces[:1]}
+	if algo.Verify(challenge, short, "127.0.0.1") {
+		t.Error("Verify returned true for a solution with too few nonces")
+	}
+}
+
+func BenchmarkVerify_HashcashSHA256(b *testing.B) {
+	challenge, _ := GenerateChallenge("127.0.0.1", 16)
+	algo := HashcashSHA256{}
+	sol, err := algo.Solve(challenge)
+	if err != nil {
+		b.Fatalf("Solve failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		algo.Verify(challenge, sol, "127.0.0.1")
+	}
+}
+
+func BenchmarkVerify_Argon2id(b *testing.B) {
+	challenge, _ := GenerateChallenge("127.0.0.1", 8)
+	algo := Argon2id{}
+	sol, err := algo.Solve(challenge)
+	if err != nil {
+		b.Fatalf("Solve failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		algo.Verify(challenge, sol, "127.0.0.1")
+	}
+}
+
+func BenchmarkVerify_Equihash(b *testing.B) {
+	challenge, _ := GenerateChallenge("127.0.0.1", 8)
+	algo := Equihash{}
+	sol, err := algo.Solve(challenge)
+	if err != nil {
+		b.Fatalf("Solve failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		algo.Verify(challenge, sol, "127.0.0.1")
+	}
+}
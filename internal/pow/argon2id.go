@@ -0,0 +1,85 @@
+package pow
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id cost parameters. Memory is in KiB; 64 MiB keeps client solve
+// time in the tens-of-milliseconds range per attempt while staying
+// cheap enough for the server to verify a single candidate quickly.
+const (
+	argon2idTime    uint32 = 1
+	argon2idMemory  uint32 = 64 * 1024
+	argon2idThreads uint8  = 4
+	argon2idKeyLen  uint32 = 32
+)
+
+// Argon2id is a memory-hard PoW scheme: the client must find a nonce such
+// that Argon2id(nonce||challenge, salt) has at least Difficulty leading
+// zero bits. The memory cost makes the search far more expensive to
+// parallelize on GPUs/ASICs than a plain hash. Unlike the other
+// algorithms, Verify isn't cheap here -- it has to redo the same
+// memory-hard derivation Solve does, since that's what "memory-hard"
+// means -- see argon2idVerifySem for how that's kept from being a DoS
+// amplifier.
+type Argon2id struct{}
+
+// argon2idVerifyConcurrency bounds how many Argon2id derivations Verify
+// may run at once, independent of how many connections the server has
+// accepted. Without this cap, every connection submitting any
+// syntactically-valid Solution -- correct or not, since Verify has to run
+// before it can tell -- forces a full ~64MiB/~48ms derivation, so
+// concurrent unauthenticated connections turn the worker pool's
+// concurrency directly into memory amplification (e.g. 100 concurrent
+// connections to an argon2id-configured server is ~6.7GB transiently
+// allocated). Capped well below typical Workers sizes so it's Verify
+// latency, not server memory, that degrades under load.
+const argon2idVerifyConcurrency = 4
+
+var argon2idVerifySem = make(chan struct{}, argon2idVerifyConcurrency)
+
+// ID implements Algorithm.
+func (Argon2id) ID() AlgorithmID { return AlgorithmArgon2id }
+
+func (Argon2id) derive(c *Challenge, nonce uint64) [32]byte {
+	input := make([]byte, 8, 8+32)
+	binary.BigEndian.PutUint64(input, nonce)
+	input = append(input, []byte(c.String())...)
+
+	var out [32]byte
+	copy(out[:], argon2.IDKey(input, c.Data[:], argon2idTime, argon2idMemory, argon2idThreads, argon2idKeyLen))
+	return out
+}
+
+// Verify implements Algorithm.
+func (a Argon2id) Verify(c *Challenge, sol Solution, clientIP string) bool {
+	if c.ClientIP != clientIP {
+		return false
+	}
+	if len(sol.Nonces) != 1 {
+		return false
+	}
+
+	argon2idVerifySem <- struct{}{}
+	defer func() { <-argon2idVerifySem }()
+
+	hash := a.derive(c, sol.Nonces[0])
+	return CountLeadingZeroBits(hash) >= c.Difficulty
+}
+
+// Solve implements Algorithm by brute-forcing nonces in order. Each
+// attempt costs a full Argon2id derivation, so this is substantially
+// slower than HashcashSHA256.Solve at the same difficulty.
+func (a Argon2id) Solve(c *Challenge) (Solution, error) {
+	for nonce := range ^uint64(0) {
+		hash := a.derive(c, nonce)
+		if CountLeadingZeroBits(hash) >= c.Difficulty {
+			return Solution{Nonces: []uint64{nonce}}, nil
+		}
+	}
+
+	return Solution{}, fmt.Errorf("no solution found")
+}
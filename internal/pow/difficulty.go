@@ -0,0 +1,105 @@
+package pow
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// DifficultyController tracks server load and derives the PoW difficulty
+// that should be handed out for the next challenge. It maintains an EWMA
+// of accepted connections per second (decayed with a configurable
+// half-life) and combines it with a per-IP penalty so that a single noisy
+// client raises its own difficulty without punishing everyone else.
+type DifficultyController struct {
+	mu sync.Mutex
+
+	base       int
+	max        int
+	targetRate float64
+	halfLife   time.Duration
+
+	ewma       float64
+	lastUpdate time.Time
+}
+
+// NewDifficultyController creates a controller that ramps difficulty
+// between base and max as the accepted-connections-per-second EWMA grows
+// past targetRate. halfLife controls how quickly the EWMA forgets past
+// load; a shorter half-life reacts faster but is noisier.
+func NewDifficultyController(base, max int, targetRate float64, halfLife time.Duration) *DifficultyController {
+	if max < base {
+		max = base
+	}
+	return &DifficultyController{
+		base:       base,
+		max:        max,
+		targetRate: targetRate,
+		halfLife:   halfLife,
+		lastUpdate: time.Now(),
+	}
+}
+
+// decayLocked applies exponential decay to the EWMA for the time elapsed
+// since the last update. Callers must hold dc.mu.
+func (dc *DifficultyController) decayLocked(now time.Time) {
+	dt := now.Sub(dc.lastUpdate)
+	dc.lastUpdate = now
+
+	if dt <= 0 || dc.halfLife <= 0 {
+		return
+	}
+
+	alpha := 1 - math.Exp(-dt.Seconds()/dc.halfLife.Seconds())
+	dc.ewma -= dc.ewma * alpha
+}
+
+// RecordAccept registers an accepted connection, bumping the load EWMA.
+// It is safe to call from multiple goroutines concurrently.
+func (dc *DifficultyController) RecordAccept() {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.decayLocked(time.Now())
+	// Each accept contributes 1/halfLife so that, under a steady accept
+	// rate, the EWMA settles at that rate in accepts/second.
+	if dc.halfLife > 0 {
+		dc.ewma += 1 / dc.halfLife.Seconds()
+	} else {
+		dc.ewma++
+	}
+}
+
+// Difficulty returns the difficulty to hand out right now, given the
+// number of recent requests seen from the requesting IP (e.g. from
+// RateLimiter.RecentCount). The result is clamped to [base, max].
+func (dc *DifficultyController) Difficulty(recentReqs int) int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	dc.decayLocked(time.Now())
+
+	loadPenalty := 0
+	if dc.targetRate > 0 && dc.ewma > 0 {
+		loadPenalty = int(math.Floor(math.Log2(1 + dc.ewma/dc.targetRate)))
+	}
+
+	perIPPenalty := 0
+	if recentReqs > 0 {
+		perIPPenalty = int(math.Floor(math.Log2(1 + float64(recentReqs))))
+	}
+
+	difficulty := dc.base + loadPenalty + perIPPenalty
+	return clamp(difficulty, dc.base, dc.max)
+}
+
+// clamp restricts v to the inclusive range [lo, hi].
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
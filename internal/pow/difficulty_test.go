@@ -0,0 +1,89 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDifficultyController_RampsUpUnderLoad(t *testing.T) {
+	dc := NewDifficultyController(4, 20, 5, 50*time.Millisecond)
+
+	prev := dc.Difficulty(0)
+	for i := 0; i < 200; i++ {
+		dc.RecordAccept()
+		got := dc.Difficulty(0)
+		if got < prev {
+			t.Fatalf("difficulty decreased under sustained load: %d -> %d", prev, got)
+		}
+		prev = got
+	}
+
+	if prev <= 4 {
+		t.Errorf("expected difficulty to ramp above base under load, got %d", prev)
+	}
+}
+
+func TestDifficultyController_RampsDownWhenIdle(t *testing.T) {
+	dc := NewDifficultyController(4, 20, 5, 20*time.Millisecond)
+
+	for i := 0; i < 200; i++ {
+		dc.RecordAccept()
+	}
+	peak := dc.Difficulty(0)
+	if peak <= 4 {
+		t.Fatalf("expected peak difficulty above base, got %d", peak)
+	}
+
+	prev := peak
+	for i := 0; i < 10; i++ {
+		time.Sleep(20 * time.Millisecond)
+		got := dc.Difficulty(0)
+		if got > prev {
+			t.Fatalf("difficulty increased while idle: %d -> %d", prev, got)
+		}
+		prev = got
+	}
+
+	if prev != 4 {
+		t.Errorf("expected difficulty to decay back to base 4, got %d", prev)
+	}
+}
+
+func TestDifficultyController_PerIPPenalty(t *testing.T) {
+	dc := NewDifficultyController(4, 20, 1000, time.Second)
+
+	quiet := dc.Difficulty(0)
+	noisy := dc.Difficulty(64)
+
+	if noisy <= quiet {
+		t.Errorf("expected noisy IP to get a higher difficulty: quiet=%d noisy=%d", quiet, noisy)
+	}
+}
+
+func TestDifficultyController_ClampsToMax(t *testing.T) {
+	dc := NewDifficultyController(4, 8, 1, time.Second)
+
+	for i := 0; i < 10000; i++ {
+		dc.RecordAccept()
+	}
+
+	if got := dc.Difficulty(100000); got > 8 {
+		t.Errorf("expected difficulty clamped to max 8, got %d", got)
+	}
+}
+
+func TestClamp(t *testing.T) {
+	tests := []struct {
+		v, lo, hi, want int
+	}{
+		{5, 0, 10, 5},
+		{-1, 0, 10, 0},
+		{20, 0, 10, 10},
+	}
+
+	for _, tt := range tests {
+		if got := clamp(tt.v, tt.lo, tt.hi); got != tt.want {
+			t.Errorf("clamp(%d, %d, %d) = %d, want %d", tt.v, tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
@@ -71,29 +71,37 @@ func CountLeadingZeroBits(hash [32]byte) int {
 	return count
 }
 
-// Verify checks if a nonce is a valid solution for this challenge
-func Verify(c *Challenge, nonce uint64, clientIP string) bool {
+// HashcashSHA256 is the original PoW scheme: find a nonce such that
+// SHA256(challenge_string + ":" + nonce) has at least Difficulty leading
+// zero bits.
+type HashcashSHA256 struct{}
+
+// ID implements Algorithm.
+func (HashcashSHA256) ID() AlgorithmID { return AlgorithmHashcashSHA256 }
+
+// Verify implements Algorithm. It is a single SHA-256 call, deliberately
+// cheap so the server can check every connection's solution.
+func (HashcashSHA256) Verify(c *Challenge, sol Solution, clientIP string) bool {
 	if c.ClientIP != clientIP {
 		return false
 	}
+	if len(sol.Nonces) != 1 {
+		return false
+	}
 
-	// Compute nonce hash
-	hash := c.ComputeHash(nonce)
-
-	// Check if difficulty is valid
-	d := CountLeadingZeroBits(hash)
-	return d >= c.Difficulty
+	hash := c.ComputeHash(sol.Nonces[0])
+	return CountLeadingZeroBits(hash) >= c.Difficulty
 }
 
-// Solve finds a nonce that satisfies the challenge difficulty
-func Solve(c *Challenge) (uint64, error) {
+// Solve implements Algorithm by brute-forcing nonces in order.
+func (HashcashSHA256) Solve(c *Challenge) (Solution, error) {
 	for nonce := range ^uint64(0) {
 		hash := c.ComputeHash(nonce)
 
 		if CountLeadingZeroBits(hash) >= c.Difficulty {
-			return nonce, nil
+			return Solution{Nonces: []uint64{nonce}}, nil
 		}
 	}
 
-	return 0, fmt.Errorf("no solution found")
+	return Solution{}, fmt.Errorf("no solution found")
 }
@@ -32,7 +32,7 @@ func TestVerify(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := Verify(challenge, tt.nonce, tt.clientIP)
+			got := (HashcashSHA256{}).Verify(challenge, Solution{Nonces: []uint64{tt.nonce}}, tt.clientIP)
 			if got != tt.want {
 				t.Errorf("Verify() = %v, want %v", got, tt.want)
 			}
@@ -63,7 +63,7 @@ func TestVerify(t *testing.T) {
 		}
 
 		// This should return true
-		if !Verify(simpleChallenge, validNonce, "127.0.0.1") {
+		if !(HashcashSHA256{}).Verify(simpleChallenge, Solution{Nonces: []uint64{validNonce}}, "127.0.0.1") {
 			hash := simpleChallenge.ComputeHash(validNonce)
 			zeroBits := CountLeadingZeroBits(hash)
 			t.Errorf("Verify() returned false for valid nonce. Nonce has %d zero bits, difficulty is %d",
@@ -133,19 +133,20 @@ func TestSolve(t *testing.T) {
 			}
 
 			t.Logf("Solving challenge with difficulty %d...", tt.difficulty)
-			nonce, err := Solve(challenge)
+			algo := HashcashSHA256{}
+			sol, err := algo.Solve(challenge)
 			if err != nil {
 				t.Fatalf("Solve() failed: %v", err)
 			}
 
-			t.Logf("Found nonce: %d", nonce)
+			t.Logf("Found nonce: %d", sol.Nonces[0])
 
 			// Verify the solution
-			if !Verify(challenge, nonce, "127.0.0.1") {
-				hash := challenge.ComputeHash(nonce)
+			if !algo.Verify(challenge, sol, "127.0.0.1") {
+				hash := challenge.ComputeHash(sol.Nonces[0])
 				zeroBits := CountLeadingZeroBits(hash)
 				t.Errorf("Verify() failed for nonce %d. Hash has %d zero bits, need %d",
-					nonce, zeroBits, tt.difficulty)
+					sol.Nonces[0], zeroBits, tt.difficulty)
 			}
 		})
 	}
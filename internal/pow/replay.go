@@ -0,0 +1,98 @@
+package pow
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// replayCache rejects reuse of an already-solved challenge across
+// connections. Entries are keyed by (random, nonces) and expire after ttl,
+// which should match the challenge's own max age -- once a token expires
+// naturally it can't be replayed anyway.
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	ttl  time.Duration
+
+	cleanupTicker *time.Ticker
+	cleanupStop   chan struct{}
+}
+
+func newReplayCache(ttl time.Duration, cleanupInterval time.Duration) *replayCache {
+	if cleanupInterval <= 0 {
+		cleanupInterval = time.Minute
+	}
+
+	rc := &replayCache{
+		seen:          make(map[string]time.Time),
+		ttl:           ttl,
+		cleanupTicker: time.NewTicker(cleanupInterval),
+		cleanupStop:   make(chan struct{}),
+	}
+
+	go rc.cleanupLoop()
+
+	return rc
+}
+
+// CheckAndMark reports whether (random, nonces) has not been seen before,
+// marking it as used for ttl. A second call with the same pair returns
+// false.
+func (rc *replayCache) CheckAndMark(random [32]byte, nonces []uint64) bool {
+	key := replayKey(random, nonces)
+	now := time.Now()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if expiresAt, ok := rc.seen[key]; ok && now.Before(expiresAt) {
+		return false
+	}
+
+	rc.seen[key] = now.Add(rc.ttl)
+	return true
+}
+
+// Stop stops the cache's cleanup goroutine.
+func (rc *replayCache) Stop() {
+	rc.cleanupTicker.Stop()
+	close(rc.cleanupStop)
+}
+
+func (rc *replayCache) cleanupLoop() {
+	for {
+		select {
+		case <-rc.cleanupTicker.C:
+			rc.cleanup()
+		case <-rc.cleanupStop:
+			return
+		}
+	}
+}
+
+func (rc *replayCache) cleanup() {
+	now := time.Now()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	for k, expiresAt := range rc.seen {
+		if now.After(expiresAt) {
+			delete(rc.seen, k)
+		}
+	}
+}
+
+func replayKey(random [32]byte, nonces []uint64) string {
+	buf := make([]byte, 0, 32+8*len(nonces))
+	buf = append(buf, random[:]...)
+
+	for _, n := range nonces {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		buf = append(buf, b[:]...)
+	}
+
+	return string(buf)
+}
@@ -0,0 +1,186 @@
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tokenBodyMinLen is the fixed-size prefix of an encoded token body:
+// 32 bytes random + 8 bytes timestamp + 1 byte difficulty + 1 byte IP length.
+const tokenBodyMinLen = 32 + 8 + 1 + 1
+
+// TokenSigner turns challenges into stateless, HMAC-signed tokens so the
+// server never has to keep a per-connection Challenge around between the
+// ChallengeResponse and Solution messages. A token is
+// random||timestamp||difficulty||len(clientIP)||clientIP||HMAC-SHA256(key, ...),
+// with the client IP after the difficulty byte rather than before it; anyone
+// holding a valid key can reconstruct and verify it without shared state,
+// which is what lets this scheme survive challenge retries or a future
+// HTTP/UDP transport and horizontal scaling behind a load balancer.
+type TokenSigner struct {
+	mu              sync.RWMutex
+	keys            [][]byte // keys[0] is current; the rest are still accepted during rotation overlap
+	maxPreviousKeys int
+	maxAge          time.Duration
+
+	replay *replayCache
+}
+
+// NewTokenSigner creates a signer using key as the initial HMAC key.
+// maxAge bounds how long an issued token remains valid, and is also used
+// as the TTL for the replay cache that rejects reusing a solved
+// challenge. maxPreviousKeys controls how many rotated-out keys are still
+// accepted, to give in-flight tokens an overlap window to be verified.
+func NewTokenSigner(key []byte, maxAge time.Duration, maxPreviousKeys int) *TokenSigner {
+	if maxPreviousKeys < 0 {
+		maxPreviousKeys = 0
+	}
+
+	return &TokenSigner{
+		keys:            [][]byte{append([]byte(nil), key...)},
+		maxPreviousKeys: maxPreviousKeys,
+		maxAge:          maxAge,
+		replay:          newReplayCache(maxAge, maxAge),
+	}
+}
+
+// RotateKey makes newKey the current signing key, keeping up to
+// maxPreviousKeys older keys acceptable for verification during the
+// overlap window.
+func (ts *TokenSigner) RotateKey(newKey []byte) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.keys = append([][]byte{append([]byte(nil), newKey...)}, ts.keys...)
+	if len(ts.keys) > ts.maxPreviousKeys+1 {
+		ts.keys = ts.keys[:ts.maxPreviousKeys+1]
+	}
+}
+
+// Stop releases the replay cache's background cleanup goroutine.
+func (ts *TokenSigner) Stop() {
+	ts.replay.Stop()
+}
+
+// Issue creates a new challenge for clientIP at the given difficulty and
+// returns both the challenge (for local logging/construction of the
+// outgoing message) and its signed token bytes.
+func (ts *TokenSigner) Issue(clientIP string, difficulty int) (*Challenge, []byte, error) {
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate random data: %w", err)
+	}
+
+	c := &Challenge{
+		Data:       random,
+		Timestamp:  time.Now().Unix(),
+		ClientIP:   clientIP,
+		Difficulty: difficulty,
+	}
+
+	return c, ts.encode(c), nil
+}
+
+// VerifyToken reconstructs the Challenge encoded in token, rejecting it if
+// the HMAC doesn't match any accepted key, it has expired, or it was
+// issued for a different client IP than clientIP.
+func (ts *TokenSigner) VerifyToken(token []byte, clientIP string) (*Challenge, error) {
+	if len(token) < tokenBodyMinLen+sha256.Size {
+		return nil, fmt.Errorf("token too short: %d bytes", len(token))
+	}
+
+	macStart := len(token) - sha256.Size
+	body, mac := token[:macStart], token[macStart:]
+
+	if !ts.validMAC(body, mac) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	c, err := decodeTokenBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.IsValid(ts.maxAge) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if c.ClientIP != clientIP {
+		return nil, fmt.Errorf("token client IP mismatch: got %s, want %s", clientIP, c.ClientIP)
+	}
+
+	return c, nil
+}
+
+// CheckAndMarkSolved reports whether (c, nonces) has not been redeemed
+// before, atomically marking it as used. A second call with the same
+// challenge and nonces -- a replayed solution -- returns false.
+func (ts *TokenSigner) CheckAndMarkSolved(c *Challenge, nonces []uint64) bool {
+	return ts.replay.CheckAndMark(c.Data, nonces)
+}
+
+func (ts *TokenSigner) encode(c *Challenge) []byte {
+	ipBytes := []byte(c.ClientIP)
+
+	body := make([]byte, 0, tokenBodyMinLen+len(ipBytes))
+	body = append(body, c.Data[:]...)
+
+	var tsBuf [8]byte
+	binary.BigEndian.PutUint64(tsBuf[:], uint64(c.Timestamp))
+	body = append(body, tsBuf[:]...)
+
+	body = append(body, byte(c.Difficulty))
+	body = append(body, byte(len(ipBytes)))
+	body = append(body, ipBytes...)
+
+	return append(body, ts.sign(body)...)
+}
+
+func (ts *TokenSigner) sign(body []byte) []byte {
+	ts.mu.RLock()
+	key := ts.keys[0]
+	ts.mu.RUnlock()
+
+	h := hmac.New(sha256.New, key)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func (ts *TokenSigner) validMAC(body, mac []byte) bool {
+	ts.mu.RLock()
+	keys := ts.keys
+	ts.mu.RUnlock()
+
+	for _, key := range keys {
+		h := hmac.New(sha256.New, key)
+		h.Write(body)
+		if hmac.Equal(h.Sum(nil), mac) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeTokenBody(body []byte) (*Challenge, error) {
+	if len(body) < tokenBodyMinLen {
+		return nil, fmt.Errorf("malformed token body: %d bytes", len(body))
+	}
+
+	c := &Challenge{}
+	copy(c.Data[:], body[:32])
+	c.Timestamp = int64(binary.BigEndian.Uint64(body[32:40]))
+	c.Difficulty = int(body[40])
+
+	ipLen := int(body[41])
+	if len(body) != tokenBodyMinLen+ipLen {
+		return nil, fmt.Errorf("malformed token body: IP length mismatch")
+	}
+	c.ClientIP = string(body[42 : 42+ipLen])
+
+	return c, nil
+}
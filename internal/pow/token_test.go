@@ -0,0 +1,113 @@
+package pow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenSigner_IssueAndVerify(t *testing.T) {
+	ts := NewTokenSigner([]byte("test-key"), time.Minute, 1)
+	defer ts.Stop()
+
+	challenge, token, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	got, err := ts.VerifyToken(token, "192.168.1.1")
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %v", err)
+	}
+
+	if got.Data != challenge.Data || got.Timestamp != challenge.Timestamp ||
+		got.Difficulty != challenge.Difficulty || got.ClientIP != challenge.ClientIP {
+		t.Errorf("VerifyToken() = %+v, want %+v", got, challenge)
+	}
+}
+
+func TestTokenSigner_RejectsTamperedToken(t *testing.T) {
+	ts := NewTokenSigner([]byte("test-key"), time.Minute, 1)
+	defer ts.Stop()
+
+	_, token, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	tampered := append([]byte(nil), token...)
+	tampered[0] ^= 0xFF
+
+	if _, err := ts.VerifyToken(tampered, "192.168.1.1"); err == nil {
+		t.Error("expected an error for a tampered token")
+	}
+}
+
+func TestTokenSigner_RejectsWrongClientIP(t *testing.T) {
+	ts := NewTokenSigner([]byte("test-key"), time.Minute, 1)
+	defer ts.Stop()
+
+	_, token, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	if _, err := ts.VerifyToken(token, "10.0.0.1"); err == nil {
+		t.Error("expected an error for a client IP mismatch")
+	}
+}
+
+func TestTokenSigner_RejectsExpiredToken(t *testing.T) {
+	ts := NewTokenSigner([]byte("test-key"), 10*time.Millisecond, 1)
+	defer ts.Stop()
+
+	_, token, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := ts.VerifyToken(token, "192.168.1.1"); err == nil {
+		t.Error("expected an error for an expired token")
+	}
+}
+
+func TestTokenSigner_RotateKey_AcceptsOverlapWindow(t *testing.T) {
+	ts := NewTokenSigner([]byte("key-v1"), time.Minute, 1)
+	defer ts.Stop()
+
+	_, token, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	ts.RotateKey([]byte("key-v2"))
+
+	if _, err := ts.VerifyToken(token, "192.168.1.1"); err != nil {
+		t.Errorf("expected token signed with the rotated-out key to still verify, got: %v", err)
+	}
+
+	ts.RotateKey([]byte("key-v3"))
+
+	if _, err := ts.VerifyToken(token, "192.168.1.1"); err == nil {
+		t.Error("expected a token signed two rotations ago (beyond the overlap window) to be rejected")
+	}
+}
+
+func TestTokenSigner_CheckAndMarkSolved_RejectsReplay(t *testing.T) {
+	ts := NewTokenSigner([]byte("test-key"), time.Minute, 1)
+	defer ts.Stop()
+
+	challenge, _, err := ts.Issue("192.168.1.1", 8)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+
+	nonces := []uint64{42}
+	if !ts.CheckAndMarkSolved(challenge, nonces) {
+		t.Fatal("expected the first redemption to succeed")
+	}
+	if ts.CheckAndMarkSolved(challenge, nonces) {
+		t.Error("expected a replayed (challenge, nonces) pair to be rejected")
+	}
+}
@@ -6,128 +6,214 @@ import (
 	"io"
 )
 
-// WriteMessage writes a message to the writer
-// Message format: [1 byte: MessageType][4 bytes: PayloadLength][N bytes: Payload]
+// WriteMessage writes a message to the writer using the current framed
+// wire format (see frame.go for the byte layout).
 func WriteMessage(w io.Writer, msg *Message) error {
-	// Write message type (1 byte)
-	if err := binary.Write(w, binary.BigEndian, msg.Type); err != nil {
-		return fmt.Errorf("failed to write message type: %w", err)
-	}
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
 
-	// Write payload length (4 bytes)
-	payloadLen := uint32(len(msg.Payload))
-	if err := binary.Write(w, binary.BigEndian, payloadLen); err != nil {
-		return fmt.Errorf("failed to write payload length: %w", err)
+	if err := writeFramedMessage(w, msg, buf); err != nil {
+		return err
 	}
-
-	// Write payload
-	if payloadLen > 0 {
-		if _, err := w.Write(msg.Payload); err != nil {
-			return fmt.Errorf("failed to write payload: %w", err)
-		}
-	}
-
+	traceFrame(msg)
 	return nil
 }
 
-// ReadMessage reads a message from the reader
+// ReadMessage reads a message from the reader. It decodes the current
+// framed format (magic + version + CRC32C), falling back to the original
+// unversioned frame for peers that predate it.
 func ReadMessage(r io.Reader) (*Message, error) {
-	msg := &Message{}
-
-	// Read message type (1 byte)
-	if err := binary.Read(r, binary.BigEndian, &msg.Type); err != nil {
-		return nil, fmt.Errorf("failed to read message type: %w", err)
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame header: %w", err)
 	}
 
-	// Read payload length (4 bytes)
-	var payloadLen uint32
-	if err := binary.Read(r, binary.BigEndian, &payloadLen); err != nil {
-		return nil, fmt.Errorf("failed to read payload length: %w", err)
+	if head != frameMagic {
+		msg, err := readLegacyMessage(r, head)
+		if err != nil {
+			return nil, err
+		}
+		traceFrame(msg)
+		return msg, nil
 	}
 
-	// Validate payload length (max 1MB to prevent memory attacks)
-	if payloadLen > 1024*1024 {
-		return nil, fmt.Errorf("payload too large: %d bytes", payloadLen)
-	}
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
 
-	// Read payload
-	if payloadLen > 0 {
-		msg.Payload = make([]byte, payloadLen)
-		if _, err := io.ReadFull(r, msg.Payload); err != nil {
-			return nil, fmt.Errorf("failed to read payload: %w", err)
-		}
+	msg, err := readFramedMessage(r, buf)
+	if err != nil {
+		return nil, err
 	}
 
+	// readFramedMessage's payload aliases buf, which we're about to return
+	// to the pool -- copy it out so the caller gets an owned slice.
+	msg.Payload = append([]byte(nil), msg.Payload...)
+	traceFrame(msg)
 	return msg, nil
 }
 
+// challengeRequestFlagWantEncrypted marks that the client wants the server
+// to encrypt the post-solution Quote/Error payload (see DeriveEncryptionKey).
+const challengeRequestFlagWantEncrypted = 0x01
+
+// EncodeChallengeRequest encodes a ChallengeRequest into bytes
+// Payload format: [1 byte: Flags (bit0 = WantEncrypted)]
+func EncodeChallengeRequest(cr *ChallengeRequest) ([]byte, error) {
+	var flags byte
+	if cr.WantEncrypted {
+		flags |= challengeRequestFlagWantEncrypted
+	}
+	return []byte{flags}, nil
+}
+
+// DecodeChallengeRequest decodes bytes into a ChallengeRequest. An empty
+// payload, from clients that predate WantEncrypted, decodes to the zero
+// value.
+func DecodeChallengeRequest(payload []byte) (*ChallengeRequest, error) {
+	cr := &ChallengeRequest{}
+	if len(payload) > 0 {
+		cr.WantEncrypted = payload[0]&challengeRequestFlagWantEncrypted != 0
+	}
+	return cr, nil
+}
+
+// maxTokenLen is the largest Token EncodeChallengeResponse/EncodeSolution
+// will accept; it must fit in the 1-byte TokenLen prefix.
+const maxTokenLen = 255
+
 // EncodeChallengeResponse encodes a ChallengeResponse into bytes
-// Payload format: [1 byte: Difficulty][8 bytes: Timestamp][32 bytes: Random Data][N bytes: Client IP]
+// Payload format: [1 byte: Algorithm][1 byte: Difficulty][8 bytes: Timestamp][32 bytes: Random Data][1 byte: TokenLen][TokenLen bytes: Token][N bytes: Client IP]
 func EncodeChallengeResponse(cr *ChallengeResponse) ([]byte, error) {
+	if len(cr.Token) > maxTokenLen {
+		return nil, fmt.Errorf("token too long: %d (max %d)", len(cr.Token), maxTokenLen)
+	}
+
 	clientIPBytes := []byte(cr.ClientIP)
-	buf := make([]byte, 41+len(clientIPBytes))
+	buf := make([]byte, 43+len(cr.Token)+len(clientIPBytes))
+
+	// Encode algorithm (1 byte)
+	buf[0] = cr.Algorithm
 
 	// Encode difficulty (1 byte)
-	buf[0] = byte(cr.Difficulty)
+	buf[1] = byte(cr.Difficulty)
 
 	// Encode timestamp (8 bytes)
-	binary.BigEndian.PutUint64(buf[1:9], uint64(cr.Timestamp))
+	binary.BigEndian.PutUint64(buf[2:10], uint64(cr.Timestamp))
 
 	// Encode random data (32 bytes)
-	copy(buf[9:41], cr.RandomData[:])
+	copy(buf[10:42], cr.RandomData[:])
+
+	// Encode token length (1 byte) and token
+	buf[42] = byte(len(cr.Token))
+	tokenEnd := 43 + len(cr.Token)
+	copy(buf[43:tokenEnd], cr.Token)
 
 	// Encode client IP (N bytes)
-	copy(buf[41:], clientIPBytes)
+	copy(buf[tokenEnd:], clientIPBytes)
 
 	return buf, nil
 }
 
 // DecodeChallengeResponse decodes bytes into a ChallengeResponse
 func DecodeChallengeResponse(payload []byte) (*ChallengeResponse, error) {
-	if len(payload) < 41 {
-		return nil, fmt.Errorf("invalid payload length: expected at least 41, got %d", len(payload))
+	if len(payload) < 43 {
+		return nil, fmt.Errorf("invalid payload length: expected at least 43, got %d", len(payload))
 	}
 
 	cr := &ChallengeResponse{}
 
+	// Decode algorithm (1 byte)
+	cr.Algorithm = payload[0]
+
 	// Decode difficulty (1 byte)
-	cr.Difficulty = int(payload[0])
+	cr.Difficulty = int(payload[1])
 
 	// Decode timestamp (8 bytes)
-	cr.Timestamp = int64(binary.BigEndian.Uint64(payload[1:9]))
+	cr.Timestamp = int64(binary.BigEndian.Uint64(payload[2:10]))
 
 	// Decode random data (32 bytes)
-	copy(cr.RandomData[:], payload[9:41])
+	copy(cr.RandomData[:], payload[10:42])
+
+	// Decode token length (1 byte) and token
+	tokenLen := int(payload[42])
+	tokenEnd := 43 + tokenLen
+	if len(payload) < tokenEnd {
+		return nil, fmt.Errorf("invalid payload length: expected at least %d, got %d", tokenEnd, len(payload))
+	}
+	if tokenLen > 0 {
+		cr.Token = append([]byte(nil), payload[43:tokenEnd]...)
+	}
 
 	// Decode client IP (N bytes)
-	if len(payload) > 41 {
-		cr.ClientIP = string(payload[41:])
+	if len(payload) > tokenEnd {
+		cr.ClientIP = string(payload[tokenEnd:])
 	}
 
 	return cr, nil
 }
 
+// maxSolutionNonces is the largest nonce count EncodeSolution will accept;
+// it must fit in the 1-byte NonceCount prefix.
+const maxSolutionNonces = 255
+
 // EncodeSolution encodes a Solution into bytes
-// Payload format: [8 bytes: Nonce]
+// Payload format: [1 byte: TokenLen][TokenLen bytes: Token][1 byte: NonceCount][NonceCount * 8 bytes: Nonces]
 func EncodeSolution(sol *Solution) ([]byte, error) {
-	buf := make([]byte, 8)
+	if len(sol.Token) > maxTokenLen {
+		return nil, fmt.Errorf("token too long: %d (max %d)", len(sol.Token), maxTokenLen)
+	}
+	if len(sol.Nonces) > maxSolutionNonces {
+		return nil, fmt.Errorf("too many nonces: %d (max %d)", len(sol.Nonces), maxSolutionNonces)
+	}
+
+	tokenEnd := 1 + len(sol.Token)
+	buf := make([]byte, tokenEnd+1+8*len(sol.Nonces))
 
-	// Encode nonce (8 bytes) - uint64 BigEndian
-	binary.BigEndian.PutUint64(buf, sol.Nonce)
+	// Encode token length (1 byte) and token
+	buf[0] = byte(len(sol.Token))
+	copy(buf[1:tokenEnd], sol.Token)
+
+	// Encode nonce count (1 byte)
+	buf[tokenEnd] = byte(len(sol.Nonces))
+
+	// Encode nonces (8 bytes each) - uint64 BigEndian
+	for i, nonce := range sol.Nonces {
+		binary.BigEndian.PutUint64(buf[tokenEnd+1+i*8:tokenEnd+9+i*8], nonce)
+	}
 
 	return buf, nil
 }
 
 // DecodeSolution decodes bytes into a Solution
 func DecodeSolution(payload []byte) (*Solution, error) {
-	if len(payload) != 8 {
-		return nil, fmt.Errorf("invalid payload length: expected 8, got %d", len(payload))
+	if len(payload) < 1 {
+		return nil, fmt.Errorf("invalid payload length: expected at least 1, got %d", len(payload))
+	}
+
+	tokenLen := int(payload[0])
+	tokenEnd := 1 + tokenLen
+	if len(payload) < tokenEnd+1 {
+		return nil, fmt.Errorf("invalid payload length: expected at least %d, got %d", tokenEnd+1, len(payload))
 	}
 
-	// Decode nonce (8 bytes) - BigEndian uint64
-	nonce := binary.BigEndian.Uint64(payload)
+	sol := &Solution{}
+	if tokenLen > 0 {
+		sol.Token = append([]byte(nil), payload[1:tokenEnd]...)
+	}
+
+	count := int(payload[tokenEnd])
+	want := tokenEnd + 1 + 8*count
+	if len(payload) != want {
+		return nil, fmt.Errorf("invalid payload length: expected %d, got %d", want, len(payload))
+	}
+
+	nonces := make([]uint64, count)
+	for i := 0; i < count; i++ {
+		nonces[i] = binary.BigEndian.Uint64(payload[tokenEnd+1+i*8 : tokenEnd+9+i*8])
+	}
+	sol.Nonces = nonces
 
-	return &Solution{Nonce: nonce}, nil
+	return sol, nil
 }
 
 // EncodeQuote encodes a Quote into bytes
@@ -51,17 +51,21 @@ func TestEncodeDecodeError(t *testing.T) {
 func TestDecodeSolution(t *testing.T) {
 	tests := []struct {
 		name    string
-		nonce   uint64
+		token   []byte
+		nonces  []uint64
 		wantErr bool
 	}{
-		{"Small nonce", 42, false},
-		{"Large nonce", 18446744073709551615, false},
-		{"Zero", 0, false},
+		{"Small nonce", []byte("tok"), []uint64{42}, false},
+		{"Large nonce", []byte("tok"), []uint64{18446744073709551615}, false},
+		{"Zero", []byte("tok"), []uint64{0}, false},
+		{"No nonces", []byte("tok"), []uint64{}, false},
+		{"Multiple nonces", []byte("tok"), []uint64{1, 2, 3, 4}, false},
+		{"No token", nil, []uint64{42}, false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			original := &Solution{Nonce: tt.nonce}
+			original := &Solution{Token: tt.token, Nonces: tt.nonces}
 
 			encoded, err := EncodeSolution(original)
 			if err != nil {
@@ -74,33 +78,61 @@ func TestDecodeSolution(t *testing.T) {
 				return
 			}
 
-			if !tt.wantErr && decoded.Nonce != original.Nonce {
-				t.Errorf("Nonce mismatch: got %d, want %d", decoded.Nonce, original.Nonce)
+			if !tt.wantErr {
+				if string(decoded.Token) != string(original.Token) {
+					t.Errorf("Token mismatch: got %q, want %q", decoded.Token, original.Token)
+				}
+				if len(decoded.Nonces) != len(original.Nonces) {
+					t.Fatalf("Nonces length mismatch: got %d, want %d", len(decoded.Nonces), len(original.Nonces))
+				}
+				for i, n := range original.Nonces {
+					if decoded.Nonces[i] != n {
+						t.Errorf("Nonces[%d] mismatch: got %d, want %d", i, decoded.Nonces[i], n)
+					}
+				}
 			}
 		})
 	}
 }
 
+func TestEncodeSolution_TooManyNonces(t *testing.T) {
+	sol := &Solution{Nonces: make([]uint64, maxSolutionNonces+1)}
+	if _, err := EncodeSolution(sol); err == nil {
+		t.Error("expected an error for a solution exceeding the max nonce count")
+	}
+}
+
+func TestEncodeSolution_TokenTooLong(t *testing.T) {
+	sol := &Solution{Token: make([]byte, maxTokenLen+1), Nonces: []uint64{1}}
+	if _, err := EncodeSolution(sol); err == nil {
+		t.Error("expected an error for a token exceeding the max length")
+	}
+}
+
 func TestEncodeDecode_ChallengeResponse(t *testing.T) {
 	tests := []struct {
 		name       string
+		algorithm  byte
 		difficulty int
 		timestamp  int64
 		randomData [32]byte
+		token      []byte
 		clientIP   string
 	}{
-		{"Standard challenge", 20, 1234567890, [32]byte{1, 2, 3, 4, 5}, "192.168.1.1"},
-		{"Zero difficulty", 0, 0, [32]byte{}, "127.0.0.1"},
-		{"Max difficulty", 255, 9999999999, [32]byte{255, 255, 255, 255}, "10.0.0.1"},
-		{"Empty IP", 20, 1234567890, [32]byte{1, 2, 3}, ""},
+		{"Standard challenge", 1, 20, 1234567890, [32]byte{1, 2, 3, 4, 5}, []byte("a-signed-token"), "192.168.1.1"},
+		{"Zero difficulty", 0, 0, 0, [32]byte{}, nil, "127.0.0.1"},
+		{"Max difficulty", 3, 255, 9999999999, [32]byte{255, 255, 255, 255}, []byte("tok"), "10.0.0.1"},
+		{"Empty IP", 2, 20, 1234567890, [32]byte{1, 2, 3}, []byte("tok"), ""},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			original := &ChallengeResponse{
+				Algorithm:  tt.algorithm,
 				Difficulty: tt.difficulty,
 				Timestamp:  tt.timestamp,
 				RandomData: tt.randomData,
+				Token:      tt.token,
 				ClientIP:   tt.clientIP,
 			}
 
@@ -119,6 +151,9 @@ func TestEncodeDecode_ChallengeResponse(t *testing.T) {
 			}
 
 			// Verify
+			if decoded.Algorithm != original.Algorithm {
+				t.Errorf("Algorithm mismatch: got %d, want %d", decoded.Algorithm, original.Algorithm)
+			}
 			if decoded.Difficulty != original.Difficulty {
 				t.Errorf("Difficulty mismatch: got %d, want %d", decoded.Difficulty, original.Difficulty)
 			}
@@ -128,9 +163,19 @@ func TestEncodeDecode_ChallengeResponse(t *testing.T) {
 			if decoded.RandomData != original.RandomData {
 				t.Errorf("RandomData mismatch")
 			}
+			if string(decoded.Token) != string(original.Token) {
+				t.Errorf("Token mismatch: got %q, want %q", decoded.Token, original.Token)
+			}
 			if decoded.ClientIP != original.ClientIP {
 				t.Errorf("ClientIP mismatch: got %q, want %q", decoded.ClientIP, original.ClientIP)
 			}
 		})
 	}
 }
+
+func TestEncodeChallengeResponse_TokenTooLong(t *testing.T) {
+	cr := &ChallengeResponse{Token: make([]byte, maxTokenLen+1)}
+	if _, err := EncodeChallengeResponse(cr); err == nil {
+		t.Error("expected an error for a token exceeding the max length")
+	}
+}
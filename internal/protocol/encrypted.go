@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// DeriveEncryptionKey derives the symmetric key for the encrypted-channel
+// option from the challenge's RandomData, the nonce the client solved it
+// with, and clientIP. Both sides compute it independently once a solution
+// exists -- the server from the Challenge it just verified, the client from
+// the nonce algo.Solve returned -- so no key ever goes over the wire, and
+// deriving it at all requires a valid PoW solution.
+func DeriveEncryptionKey(randomData [32]byte, nonce uint64, clientIP string) [32]byte {
+	h := sha256.New()
+	h.Write(randomData[:])
+	var nonceBuf [8]byte
+	binary.BigEndian.PutUint64(nonceBuf[:], nonce)
+	h.Write(nonceBuf[:])
+	h.Write([]byte(clientIP))
+
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// encryptPayload encrypts plaintext with AES-CFB under key, prefixes the
+// random IV, and base64-encodes the result into the payload bytes.
+func encryptPayload(key [32]byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	combined := make([]byte, aes.BlockSize+len(plaintext))
+	iv := combined[:aes.BlockSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	stream := cipher.NewCFBEncrypter(block, iv)
+	stream.XORKeyStream(combined[aes.BlockSize:], plaintext)
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(combined)))
+	base64.StdEncoding.Encode(encoded, combined)
+	return encoded, nil
+}
+
+// decryptPayload reverses encryptPayload.
+func decryptPayload(key [32]byte, payload []byte) ([]byte, error) {
+	combined := make([]byte, base64.StdEncoding.DecodedLen(len(payload)))
+	n, err := base64.StdEncoding.Decode(combined, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode payload: %w", err)
+	}
+	combined = combined[:n]
+
+	if len(combined) < aes.BlockSize {
+		return nil, fmt.Errorf("invalid payload length: expected at least %d, got %d", aes.BlockSize, len(combined))
+	}
+	iv, ciphertext := combined[:aes.BlockSize], combined[aes.BlockSize:]
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	stream := cipher.NewCFBDecrypter(block, iv)
+	stream.XORKeyStream(plaintext, ciphertext)
+	return plaintext, nil
+}
+
+// EncodeQuoteEncrypted encodes a Quote the same way EncodeQuote does, then
+// encrypts the result under key (see DeriveEncryptionKey).
+func EncodeQuoteEncrypted(q *Quote, key [32]byte) ([]byte, error) {
+	plaintext, err := EncodeQuote(q)
+	if err != nil {
+		return nil, err
+	}
+	return encryptPayload(key, plaintext)
+}
+
+// DecodeQuoteEncrypted reverses EncodeQuoteEncrypted.
+func DecodeQuoteEncrypted(payload []byte, key [32]byte) (*Quote, error) {
+	plaintext, err := decryptPayload(key, payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeQuote(plaintext)
+}
+
+// EncodeErrorEncrypted encodes an Error the same way EncodeError does, then
+// encrypts the result under key (see DeriveEncryptionKey).
+func EncodeErrorEncrypted(e *Error, key [32]byte) ([]byte, error) {
+	plaintext, err := EncodeError(e)
+	if err != nil {
+		return nil, err
+	}
+	return encryptPayload(key, plaintext)
+}
+
+// DecodeErrorEncrypted reverses EncodeErrorEncrypted.
+func DecodeErrorEncrypted(payload []byte, key [32]byte) (*Error, error) {
+	plaintext, err := decryptPayload(key, payload)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeError(plaintext)
+}
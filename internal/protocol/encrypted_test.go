@@ -0,0 +1,106 @@
+package protocol
+
+import "testing"
+
+func TestEncodeDecodeChallengeRequest(t *testing.T) {
+	for _, want := range []bool{false, true} {
+		payload, err := EncodeChallengeRequest(&ChallengeRequest{WantEncrypted: want})
+		if err != nil {
+			t.Fatalf("EncodeChallengeRequest failed: %v", err)
+		}
+
+		decoded, err := DecodeChallengeRequest(payload)
+		if err != nil {
+			t.Fatalf("DecodeChallengeRequest failed: %v", err)
+		}
+		if decoded.WantEncrypted != want {
+			t.Errorf("WantEncrypted = %v, want %v", decoded.WantEncrypted, want)
+		}
+	}
+}
+
+func TestDecodeChallengeRequest_EmptyPayload(t *testing.T) {
+	decoded, err := DecodeChallengeRequest(nil)
+	if err != nil {
+		t.Fatalf("DecodeChallengeRequest failed: %v", err)
+	}
+	if decoded.WantEncrypted {
+		t.Error("WantEncrypted should default to false for an empty (pre-upgrade) payload")
+	}
+}
+
+func TestQuoteEncrypted_RoundTrip(t *testing.T) {
+	var randomData [32]byte
+	copy(randomData[:], []byte("some challenge random data here"))
+	key := DeriveEncryptionKey(randomData, 42, "203.0.113.5")
+
+	quote := &Quote{Text: "The only true wisdom is in knowing you know nothing."}
+
+	payload, err := EncodeQuoteEncrypted(quote, key)
+	if err != nil {
+		t.Fatalf("EncodeQuoteEncrypted failed: %v", err)
+	}
+
+	decoded, err := DecodeQuoteEncrypted(payload, key)
+	if err != nil {
+		t.Fatalf("DecodeQuoteEncrypted failed: %v", err)
+	}
+	if decoded.Text != quote.Text {
+		t.Errorf("Text = %q, want %q", decoded.Text, quote.Text)
+	}
+}
+
+func TestQuoteEncrypted_WrongNonceFails(t *testing.T) {
+	var randomData [32]byte
+	copy(randomData[:], []byte("some challenge random data here"))
+
+	encKey := DeriveEncryptionKey(randomData, 42, "203.0.113.5")
+	payload, err := EncodeQuoteEncrypted(&Quote{Text: "secret wisdom"}, encKey)
+	if err != nil {
+		t.Fatalf("EncodeQuoteEncrypted failed: %v", err)
+	}
+
+	wrongKey := DeriveEncryptionKey(randomData, 43, "203.0.113.5")
+	decoded, err := DecodeQuoteEncrypted(payload, wrongKey)
+	if err == nil && decoded.Text == "secret wisdom" {
+		t.Error("decrypting with the wrong nonce must not recover the original plaintext")
+	}
+}
+
+func TestQuoteEncrypted_WrongClientIPFails(t *testing.T) {
+	var randomData [32]byte
+	copy(randomData[:], []byte("some challenge random data here"))
+
+	encKey := DeriveEncryptionKey(randomData, 42, "203.0.113.5")
+	payload, err := EncodeQuoteEncrypted(&Quote{Text: "secret wisdom"}, encKey)
+	if err != nil {
+		t.Fatalf("EncodeQuoteEncrypted failed: %v", err)
+	}
+
+	wrongKey := DeriveEncryptionKey(randomData, 42, "198.51.100.9")
+	decoded, err := DecodeQuoteEncrypted(payload, wrongKey)
+	if err == nil && decoded.Text == "secret wisdom" {
+		t.Error("decrypting with the wrong client IP must not recover the original plaintext")
+	}
+}
+
+func TestErrorEncrypted_RoundTrip(t *testing.T) {
+	var randomData [32]byte
+	copy(randomData[:], []byte("another challenge's random data"))
+	key := DeriveEncryptionKey(randomData, 7, "198.51.100.9")
+
+	want := &Error{Code: ErrorCodeInternalError, Message: "no quotes available"}
+
+	payload, err := EncodeErrorEncrypted(want, key)
+	if err != nil {
+		t.Fatalf("EncodeErrorEncrypted failed: %v", err)
+	}
+
+	decoded, err := DecodeErrorEncrypted(payload, key)
+	if err != nil {
+		t.Fatalf("DecodeErrorEncrypted failed: %v", err)
+	}
+	if decoded.Code != want.Code || decoded.Message != want.Message {
+		t.Errorf("decoded = %+v, want %+v", decoded, want)
+	}
+}
@@ -0,0 +1,244 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Frame format: [2 bytes: Magic "PW"][1 byte: Version][1 byte: MessageType][4 bytes: PayloadLength][N bytes: Payload][4 bytes: CRC32C(Type||PayloadLength||Payload)]
+//
+// ReadMessage falls back to decoding the original unversioned frame
+// ([1 byte: MessageType][4 bytes: PayloadLength][N bytes: Payload], no
+// magic/CRC) whenever the first two bytes on the wire don't match
+// frameMagic, so peers that predate this framing upgrade still interop.
+
+var frameMagic = [2]byte{'P', 'W'}
+
+// ProtocolVersion is the current framed wire format version.
+const ProtocolVersion byte = 1
+
+// crcSize is the size in bytes of the trailing CRC32C.
+const crcSize = 4
+
+// frameHeaderSize is magic(2) + version(1) + type(1) + payload length(4).
+const frameHeaderSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// defaultMaxPayloadSize bounds any MessageType not listed in
+// maxPayloadSizes below.
+const defaultMaxPayloadSize = 1024 * 1024
+
+var maxPayloadSizesMu sync.RWMutex
+var maxPayloadSizes = map[MessageType]uint32{
+	MessageTypeChallengeRequest:  64,
+	MessageTypeChallengeResponse: 1024,
+	MessageTypeSolution:          2048,
+	MessageTypeQuote:             64 * 1024,
+	MessageTypeError:             4096,
+}
+
+// SetMaxPayloadSize overrides the maximum payload size ReadMessage and
+// Decoder.Decode will accept for mt, replacing the package default. Intended
+// for deployments or tests whose message shapes differ from this package's
+// own.
+func SetMaxPayloadSize(mt MessageType, n uint32) {
+	maxPayloadSizesMu.Lock()
+	defer maxPayloadSizesMu.Unlock()
+	maxPayloadSizes[mt] = n
+}
+
+func maxPayloadSizeFor(mt MessageType) uint32 {
+	maxPayloadSizesMu.RLock()
+	defer maxPayloadSizesMu.RUnlock()
+	if n, ok := maxPayloadSizes[mt]; ok {
+		return n
+	}
+	return defaultMaxPayloadSize
+}
+
+// bufferPool holds reusable byte slices for Encoder/Decoder so a high-QPS
+// server doesn't churn the allocator on every frame. Pooling a pointer to
+// the slice (rather than the slice itself) avoids an extra allocation when
+// boxing the value for the interface{} sync.Pool expects.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+func writeFramedMessage(w io.Writer, msg *Message, buf *[]byte) error {
+	total := frameHeaderSize + len(msg.Payload) + crcSize
+	if cap(*buf) < total {
+		*buf = make([]byte, total)
+	} else {
+		*buf = (*buf)[:total]
+	}
+	b := *buf
+
+	b[0], b[1] = frameMagic[0], frameMagic[1]
+	b[2] = ProtocolVersion
+	b[3] = byte(msg.Type)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(msg.Payload)))
+	copy(b[8:8+len(msg.Payload)], msg.Payload)
+
+	crc := crc32.Checksum(b[3:8+len(msg.Payload)], crcTable)
+	binary.BigEndian.PutUint32(b[8+len(msg.Payload):], crc)
+
+	if _, err := w.Write(b); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// readFramedMessage reads a current-format frame, with the 2-byte magic
+// already consumed and verified by the caller.
+func readFramedMessage(r io.Reader, buf *[]byte) (*Message, error) {
+	var rest [frameHeaderSize - 2]byte // version(1) + type(1) + length(4)
+	if _, err := io.ReadFull(r, rest[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame header: %w", err)
+	}
+
+	version := rest[0]
+	if version != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version: %d", version)
+	}
+
+	msgType := MessageType(rest[1])
+	payloadLen := binary.BigEndian.Uint32(rest[2:6])
+
+	maxSize := maxPayloadSizeFor(msgType)
+	if payloadLen > maxSize {
+		return nil, fmt.Errorf("payload too large for message type %d: %d bytes (max %d)", msgType, payloadLen, maxSize)
+	}
+
+	if cap(*buf) < int(payloadLen) {
+		*buf = make([]byte, payloadLen)
+	} else {
+		*buf = (*buf)[:payloadLen]
+	}
+	payload := *buf
+	if payloadLen > 0 {
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, fmt.Errorf("failed to read payload: %w", err)
+		}
+	}
+
+	var crcBuf [crcSize]byte
+	if _, err := io.ReadFull(r, crcBuf[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame crc: %w", err)
+	}
+
+	crc := crc32.New(crcTable)
+	crc.Write(rest[1:]) // type + length
+	crc.Write(payload)
+	if crc.Sum32() != binary.BigEndian.Uint32(crcBuf[:]) {
+		return nil, fmt.Errorf("frame crc mismatch")
+	}
+
+	return &Message{Type: msgType, Payload: payload}, nil
+}
+
+// readLegacyMessage decodes the original unversioned frame format for
+// peers that predate this package's framing upgrade. head is the two
+// bytes already consumed from r while probing for the magic prefix:
+// head[0] is the MessageType and head[1] is the first byte of the
+// big-endian length prefix.
+func readLegacyMessage(r io.Reader, head [2]byte) (*Message, error) {
+	msgType := MessageType(head[0])
+
+	var lenRest [3]byte
+	if _, err := io.ReadFull(r, lenRest[:]); err != nil {
+		return nil, fmt.Errorf("failed to read payload length: %w", err)
+	}
+	payloadLen := binary.BigEndian.Uint32([]byte{head[1], lenRest[0], lenRest[1], lenRest[2]})
+
+	maxSize := maxPayloadSizeFor(msgType)
+	if payloadLen > maxSize {
+		return nil, fmt.Errorf("payload too large for message type %d: %d bytes (max %d)", msgType, payloadLen, maxSize)
+	}
+
+	payload := make([]byte, payloadLen)
+	if payloadLen > 0 {
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return nil, fmt.Errorf("failed to read payload: %w", err)
+		}
+	}
+
+	return &Message{Type: msgType, Payload: payload}, nil
+}
+
+// Encoder writes framed, CRC-checked messages to an underlying writer,
+// reusing an internal buffer across Encode calls to avoid allocating a new
+// header+payload buffer per message under high QPS.
+type Encoder struct {
+	w   io.Writer
+	buf *[]byte
+}
+
+// NewEncoder creates an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, buf: bufferPool.Get().(*[]byte)}
+}
+
+// Encode writes msg as a single frame.
+func (e *Encoder) Encode(msg *Message) error {
+	if err := writeFramedMessage(e.w, msg, e.buf); err != nil {
+		return err
+	}
+	traceFrame(msg)
+	return nil
+}
+
+// Close releases the Encoder's internal buffer back to the shared pool.
+// The Encoder must not be used after Close.
+func (e *Encoder) Close() {
+	bufferPool.Put(e.buf)
+	e.buf = nil
+}
+
+// Decoder reads framed, CRC-checked messages from an underlying reader,
+// reusing an internal buffer across Decode calls to avoid allocating a new
+// payload buffer per message under high QPS. Unlike the package-level
+// ReadMessage, Decoder does not fall back to the legacy unversioned frame
+// format -- it's meant for sustained, current-protocol connections.
+type Decoder struct {
+	r   io.Reader
+	buf *[]byte
+}
+
+// NewDecoder creates a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, buf: bufferPool.Get().(*[]byte)}
+}
+
+// Decode reads the next frame. The returned Message's Payload aliases the
+// Decoder's internal buffer and is only valid until the next call to
+// Decode; copy it if it needs to outlive that call.
+func (d *Decoder) Decode() (*Message, error) {
+	var magic [2]byte
+	if _, err := io.ReadFull(d.r, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read frame magic: %w", err)
+	}
+	if magic != frameMagic {
+		return nil, fmt.Errorf("bad frame magic: %x", magic)
+	}
+
+	msg, err := readFramedMessage(d.r, d.buf)
+	if err != nil {
+		return nil, err
+	}
+	traceFrame(msg)
+	return msg, nil
+}
+
+// Close releases the Decoder's internal buffer back to the shared pool.
+// The Decoder must not be used after Close.
+func (d *Decoder) Close() {
+	bufferPool.Put(d.buf)
+	d.buf = nil
+}
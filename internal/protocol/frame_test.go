@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteReadMessage_RoundTrip(t *testing.T) {
+	original := &Message{Type: MessageTypeQuote, Payload: []byte("hello, wisdom")}
+
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, original); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	decoded, err := ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+
+	if decoded.Type != original.Type {
+		t.Errorf("Type mismatch: got %d, want %d", decoded.Type, original.Type)
+	}
+	if !bytes.Equal(decoded.Payload, original.Payload) {
+		t.Errorf("Payload mismatch: got %q, want %q", decoded.Payload, original.Payload)
+	}
+}
+
+func TestReadMessage_LegacyFrame(t *testing.T) {
+	// Build the original unversioned frame by hand: no magic/CRC.
+	payload := []byte("legacy payload")
+	var buf bytes.Buffer
+	buf.WriteByte(byte(MessageTypeQuote))
+	buf.Write([]byte{0, 0, 0, byte(len(payload))})
+	buf.Write(payload)
+
+	msg, err := ReadMessage(&buf)
+	if err != nil {
+		t.Fatalf("ReadMessage failed on legacy frame: %v", err)
+	}
+	if msg.Type != MessageTypeQuote {
+		t.Errorf("Type mismatch: got %d, want %d", msg.Type, MessageTypeQuote)
+	}
+	if !bytes.Equal(msg.Payload, payload) {
+		t.Errorf("Payload mismatch: got %q, want %q", msg.Payload, payload)
+	}
+}
+
+func TestReadMessage_RejectsCorruptedFrame(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, &Message{Type: MessageTypeQuote, Payload: []byte("hello")}); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xFF
+
+	if _, err := ReadMessage(bytes.NewReader(corrupted)); err == nil {
+		t.Error("expected a CRC mismatch error for a corrupted frame")
+	}
+}
+
+func TestReadMessage_RejectsOversizedPayload(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, &Message{Type: MessageTypeSolution, Payload: make([]byte, maxPayloadSizeFor(MessageTypeSolution)+1)}); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	if _, err := ReadMessage(&buf); err == nil {
+		t.Error("expected an error for a payload exceeding the per-type max")
+	}
+}
+
+func TestEncoderDecoder_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	defer enc.Close()
+
+	messages := []*Message{
+		{Type: MessageTypeChallengeRequest, Payload: nil},
+		{Type: MessageTypeQuote, Payload: []byte("a quote")},
+		{Type: MessageTypeError, Payload: []byte("an error")},
+	}
+
+	for _, m := range messages {
+		if err := enc.Encode(m); err != nil {
+			t.Fatalf("Encode failed: %v", err)
+		}
+	}
+
+	dec := NewDecoder(&buf)
+	defer dec.Close()
+
+	for i, want := range messages {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("Decode[%d] failed: %v", i, err)
+		}
+		if got.Type != want.Type {
+			t.Errorf("Decode[%d].Type = %d, want %d", i, got.Type, want.Type)
+		}
+		if !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("Decode[%d].Payload = %q, want %q", i, got.Payload, want.Payload)
+		}
+	}
+}
+
+func TestSetMaxPayloadSize(t *testing.T) {
+	const mt = MessageTypeQuote
+	original := maxPayloadSizeFor(mt)
+	defer SetMaxPayloadSize(mt, original)
+
+	SetMaxPayloadSize(mt, 4)
+
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, &Message{Type: mt, Payload: []byte("too long")}); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	if _, err := ReadMessage(&buf); err == nil {
+		t.Error("expected an error after lowering the max payload size below the frame's length")
+	}
+}
+
+func FuzzReadMessage(f *testing.F) {
+	var valid bytes.Buffer
+	WriteMessage(&valid, &Message{Type: MessageTypeQuote, Payload: []byte("seed")})
+	f.Add(valid.Bytes())
+	f.Add([]byte{})
+	f.Add([]byte{'P', 'W'})
+	f.Add([]byte{'P', 'W', ProtocolVersion, byte(MessageTypeQuote), 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{byte(MessageTypeError)})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Must never panic on malformed or truncated input.
+		ReadMessage(bytes.NewReader(data))
+	})
+}
@@ -1,5 +1,7 @@
 package protocol
 
+import "fmt"
+
 // MessageType represents the type of message in the protocol
 type MessageType byte
 
@@ -18,33 +20,100 @@ const (
 
 	// MessageTypeError is sent by server when an error occurs
 	MessageTypeError MessageType = 0x05
+
+	// MessageTypeQuoteEncrypted is sent by server instead of
+	// MessageTypeQuote when the client's ChallengeRequest set
+	// WantEncrypted; see EncodeQuoteEncrypted.
+	MessageTypeQuoteEncrypted MessageType = 0x06
+
+	// MessageTypeErrorEncrypted is sent by server instead of
+	// MessageTypeError when a solution has already been verified for this
+	// connection and the client requested the encrypted channel; see
+	// EncodeErrorEncrypted.
+	MessageTypeErrorEncrypted MessageType = 0x07
 )
 
-// Message represents a protocol message
-// Format: [1 byte: MessageType][4 bytes: PayloadLength][N bytes: Payload]
+// String returns the symbolic name of mt, as used by the frame tracer
+// (see trace.go).
+func (mt MessageType) String() string {
+	switch mt {
+	case MessageTypeChallengeRequest:
+		return "ChallengeRequest"
+	case MessageTypeChallengeResponse:
+		return "ChallengeResponse"
+	case MessageTypeSolution:
+		return "Solution"
+	case MessageTypeQuote:
+		return "Quote"
+	case MessageTypeError:
+		return "Error"
+	case MessageTypeQuoteEncrypted:
+		return "QuoteEncrypted"
+	case MessageTypeErrorEncrypted:
+		return "ErrorEncrypted"
+	default:
+		return fmt.Sprintf("MessageType(0x%02x)", byte(mt))
+	}
+}
+
+// Message represents a protocol message. See frame.go for the wire format
+// WriteMessage/ReadMessage (and Encoder/Decoder) use to serialize it.
 type Message struct {
 	Type    MessageType
 	Payload []byte
 }
 
-// ChallengeRequest represents a request for a PoW challenge
+// ChallengeRequest represents a request for a PoW challenge.
+// Payload format: [1 byte: Flags (bit0 = WantEncrypted)], or empty, for
+// clients that predate the encrypted-channel option.
 type ChallengeRequest struct {
-	// Empty payload for now
+	// WantEncrypted asks the server to encrypt the Quote/Error payload it
+	// sends once the solution is verified (see DeriveEncryptionKey). The
+	// handshake itself always stays in the clear, since the client needs
+	// the cleartext challenge to solve it.
+	WantEncrypted bool
+}
+
+// String implements fmt.Stringer for the frame tracer (see trace.go).
+func (cr *ChallengeRequest) String() string {
+	return fmt.Sprintf("ChallengeRequest{WantEncrypted:%v}", cr.WantEncrypted)
 }
 
 // ChallengeResponse represents the server's challenge
-// Payload format: [1 byte: Difficulty][8 bytes: Timestamp][32 bytes: Random Data][N bytes: Client IP]
+// Payload format: [1 byte: Algorithm][1 byte: Difficulty][8 bytes: Timestamp][32 bytes: Random Data][1 byte: TokenLen][TokenLen bytes: Token][N bytes: Client IP]
 type ChallengeResponse struct {
+	// Algorithm identifies the PoW scheme the client must use to solve
+	// this challenge; see pow.AlgorithmID for the known values.
+	Algorithm  byte
 	Difficulty int
 	Timestamp  int64
 	RandomData [32]byte
-	ClientIP   string
+	// Token is the HMAC-signed, stateless encoding of this challenge (see
+	// pow.TokenSigner). The client must echo it back unmodified in its
+	// Solution so the server can verify the solution without having kept
+	// the challenge in memory.
+	Token    []byte
+	ClientIP string
 }
 
-// Solution represents the client's PoW solution
-// Payload format: [8 bytes: Nonce]
+// String implements fmt.Stringer for the frame tracer (see trace.go).
+func (cr *ChallengeResponse) String() string {
+	return fmt.Sprintf("ChallengeResponse{Algorithm:%d Difficulty:%d Timestamp:%d RandomData:%x Token:%x ClientIP:%q}",
+		cr.Algorithm, cr.Difficulty, cr.Timestamp, cr.RandomData, cr.Token, cr.ClientIP)
+}
+
+// Solution represents the client's PoW solution. Token is the value
+// echoed back from ChallengeResponse.Token. Most algorithms need a single
+// nonce; multi-nonce schemes (e.g. the Equihash-like one) need more.
+// Payload format: [1 byte: TokenLen][TokenLen bytes: Token][1 byte: NonceCount][NonceCount * 8 bytes: Nonces]
 type Solution struct {
-	Nonce uint64
+	Token  []byte
+	Nonces []uint64
+}
+
+// String implements fmt.Stringer for the frame tracer (see trace.go).
+func (s *Solution) String() string {
+	return fmt.Sprintf("Solution{Token:%x Nonces:%v}", s.Token, s.Nonces)
 }
 
 // Quote represents a wisdom quote from the server
@@ -53,6 +122,11 @@ type Quote struct {
 	Text string
 }
 
+// String implements fmt.Stringer for the frame tracer (see trace.go).
+func (q *Quote) String() string {
+	return fmt.Sprintf("Quote{Text:%q}", q.Text)
+}
+
 // Error represents an error message
 // Payload format: [2 bytes: Error Code][N bytes: Error Message]
 type Error struct {
@@ -60,11 +134,17 @@ type Error struct {
 	Message string
 }
 
+// String implements fmt.Stringer for the frame tracer (see trace.go).
+func (e *Error) String() string {
+	return fmt.Sprintf("Error{Code:%d Message:%q}", e.Code, e.Message)
+}
+
 // Error codes
 const (
-	ErrorCodeInvalidMessage   uint16 = 1
-	ErrorCodeInvalidSolution  uint16 = 2
+	ErrorCodeInvalidMessage    uint16 = 1
+	ErrorCodeInvalidSolution   uint16 = 2
 	ErrorCodeRateLimitExceeded uint16 = 3
-	ErrorCodeTimeout          uint16 = 4
-	ErrorCodeInternalError    uint16 = 5
+	ErrorCodeTimeout           uint16 = 4
+	ErrorCodeInternalError     uint16 = 5
+	ErrorCodeServerBusy        uint16 = 6
 )
\ No newline at end of file
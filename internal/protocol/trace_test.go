@@ -0,0 +1,143 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSetTracer_EmitsAnnotatedDump(t *testing.T) {
+	var traceOut bytes.Buffer
+	SetTracer(&traceOut)
+	defer SetTracer(nil)
+
+	var wireBuf bytes.Buffer
+	msg := &Message{Type: MessageTypeQuote, Payload: []byte("trace me")}
+	if err := WriteMessage(&wireBuf, msg); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+	if _, err := ReadMessage(&wireBuf); err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+
+	out := traceOut.String()
+	if !strings.Contains(out, "Quote") {
+		t.Errorf("expected the message type name in the trace output, got: %s", out)
+	}
+	if !strings.Contains(out, `Quote{Text:"trace me"}`) {
+		t.Errorf("expected the decoded payload in the trace output, got: %s", out)
+	}
+}
+
+func TestWireDirection_MatchesMessageType(t *testing.T) {
+	clientToServer := []MessageType{MessageTypeChallengeRequest, MessageTypeSolution}
+	serverToClient := []MessageType{MessageTypeChallengeResponse, MessageTypeQuote, MessageTypeError, MessageTypeQuoteEncrypted, MessageTypeErrorEncrypted}
+
+	for _, mt := range clientToServer {
+		if got := wireDirection(mt); got != "→" {
+			t.Errorf("wireDirection(%s) = %q, want \"→\"", mt, got)
+		}
+	}
+	for _, mt := range serverToClient {
+		if got := wireDirection(mt); got != "←" {
+			t.Errorf("wireDirection(%s) = %q, want \"←\"", mt, got)
+		}
+	}
+}
+
+// TestTraceFrame_DirectionIsRoleNotLocalCall guards against tying the
+// marker to whether the local call was a Write or a Read: a server's
+// WriteMessage(ChallengeResponse) is still server→client, and a server's
+// ReadMessage(Solution) is still client→server, even though one is a local
+// write and the other a local read.
+func TestTraceFrame_DirectionIsRoleNotLocalCall(t *testing.T) {
+	// The server *writes* ChallengeResponse -- still server->client.
+	t.Run("server write of a server-to-client type", func(t *testing.T) {
+		var traceOut bytes.Buffer
+		SetTracer(&traceOut)
+		defer SetTracer(nil)
+
+		payload, err := EncodeChallengeResponse(&ChallengeResponse{RandomData: [32]byte{1}})
+		if err != nil {
+			t.Fatalf("EncodeChallengeResponse failed: %v", err)
+		}
+		var wireBuf bytes.Buffer
+		if err := WriteMessage(&wireBuf, &Message{Type: MessageTypeChallengeResponse, Payload: payload}); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+
+		if !strings.HasPrefix(traceOut.String(), "←") {
+			t.Errorf("expected WriteMessage(ChallengeResponse) to log \"←\" (server->client), got: %q", traceOut.String())
+		}
+	})
+
+	// The server *reads* Solution -- still client->server.
+	t.Run("server read of a client-to-server type", func(t *testing.T) {
+		payload, err := EncodeSolution(&Solution{Nonces: []uint64{1}})
+		if err != nil {
+			t.Fatalf("EncodeSolution failed: %v", err)
+		}
+		var wireBuf bytes.Buffer
+		if err := WriteMessage(&wireBuf, &Message{Type: MessageTypeSolution, Payload: payload}); err != nil {
+			t.Fatalf("WriteMessage failed: %v", err)
+		}
+
+		var traceOut bytes.Buffer
+		SetTracer(&traceOut)
+		defer SetTracer(nil)
+
+		if _, err := ReadMessage(&wireBuf); err != nil {
+			t.Fatalf("ReadMessage failed: %v", err)
+		}
+
+		if !strings.HasPrefix(traceOut.String(), "→") {
+			t.Errorf("expected ReadMessage(Solution) to log \"→\" (client->server), got: %q", traceOut.String())
+		}
+	})
+}
+
+func TestSetTracer_NilDisablesTracing(t *testing.T) {
+	var traceOut bytes.Buffer
+	SetTracer(&traceOut)
+	SetTracer(nil)
+
+	var wireBuf bytes.Buffer
+	if err := WriteMessage(&wireBuf, &Message{Type: MessageTypeQuote, Payload: []byte("quiet")}); err != nil {
+		t.Fatalf("WriteMessage failed: %v", err)
+	}
+
+	if traceOut.Len() != 0 {
+		t.Errorf("expected no trace output after SetTracer(nil), got: %s", traceOut.String())
+	}
+}
+
+func TestDecodeAny(t *testing.T) {
+	quotePayload, err := EncodeQuote(&Quote{Text: "known wisdom"})
+	if err != nil {
+		t.Fatalf("EncodeQuote failed: %v", err)
+	}
+
+	decoded, err := DecodeAny(quotePayload, MessageTypeQuote)
+	if err != nil {
+		t.Fatalf("DecodeAny failed: %v", err)
+	}
+	if decoded.String() != `Quote{Text:"known wisdom"}` {
+		t.Errorf("String() = %q", decoded.String())
+	}
+}
+
+func TestDecodeAny_EncryptedTypeReportsLengthOnly(t *testing.T) {
+	decoded, err := DecodeAny(make([]byte, 48), MessageTypeQuoteEncrypted)
+	if err != nil {
+		t.Fatalf("DecodeAny failed: %v", err)
+	}
+	if !strings.Contains(decoded.String(), "48 bytes") {
+		t.Errorf("String() = %q, want it to mention the payload length", decoded.String())
+	}
+}
+
+func TestDecodeAny_UnknownMessageType(t *testing.T) {
+	if _, err := DecodeAny(nil, MessageType(0xff)); err == nil {
+		t.Error("expected an error for an unknown message type")
+	}
+}
@@ -17,6 +17,7 @@ const (
 	ErrorCodeRateLimitExceeded = 3
 	ErrorCodeTimeout           = 4
 	ErrorCodeInternalError     = 5
+	ErrorCodeServerBusy        = 6
 )
 
 // sendError sends an error message to the client
@@ -44,13 +45,52 @@ func (s *Server) sendError(conn net.Conn, code uint16, message string) {
 	}
 }
 
-// handleChallengeResponse implements the PoW challenge-response protocol
-func (s *Server) handleChallengeResponse(conn net.Conn, challenge *pow.Challenge) error {
+// sendEncryptedError sends an error message encrypted under key, for use
+// once a client's solution has been verified and it requested the
+// encrypted channel. See sendError for the cleartext equivalent.
+func (s *Server) sendEncryptedError(conn net.Conn, code uint16, message string, key [32]byte) {
+	conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
+
+	errMsg := &protocol.Error{
+		Code:    code,
+		Message: message,
+	}
+
+	payload, err := protocol.EncodeErrorEncrypted(errMsg, key)
+	if err != nil {
+		log.Printf("Failed to encode encrypted error: %v", err)
+		return
+	}
+
+	msg := &protocol.Message{
+		Type:    protocol.MessageTypeErrorEncrypted,
+		Payload: payload,
+	}
+
+	if err := protocol.WriteMessage(conn, msg); err != nil {
+		log.Printf("Failed to send encrypted error: %v", err)
+	}
+}
+
+// handleChallengeResponse implements the PoW challenge-response protocol.
+// token is the HMAC-signed encoding of challenge (see pow.TokenSigner); the
+// client echoes it back in its Solution so the challenge itself never needs
+// to be kept in memory between messages.
+func (s *Server) handleChallengeResponse(conn net.Conn, challenge *pow.Challenge, token []byte, algo pow.Algorithm) error {
 	clientIP := conn.RemoteAddr().(*net.TCPAddr).IP.String()
 
+	// A worker holds this connection for its whole handshake (request,
+	// response, solution, quote), so an Encoder/Decoder pair -- reusing one
+	// pooled buffer across all four frames -- saves the per-call pool round
+	// trips WriteMessage/ReadMessage would otherwise do per message.
+	enc := protocol.NewEncoder(conn)
+	defer enc.Close()
+	dec := protocol.NewDecoder(conn)
+	defer dec.Close()
+
 	// Read challenge request from client
 	conn.SetReadDeadline(time.Now().Add(s.config.ReadTimeout))
-	msg, err := protocol.ReadMessage(conn)
+	msg, err := dec.Decode()
 	if err != nil {
 		return fmt.Errorf("failed to read challenge request: %w", err)
 	}
@@ -60,13 +100,21 @@ func (s *Server) handleChallengeResponse(conn net.Conn, challenge *pow.Challenge
 		return fmt.Errorf("unexpected message type: %d", msg.Type)
 	}
 
+	challengeReq, err := protocol.DecodeChallengeRequest(msg.Payload)
+	if err != nil {
+		s.sendError(conn, ErrorCodeInvalidMessage, "Malformed challenge request")
+		return fmt.Errorf("failed to decode challenge request: %w", err)
+	}
+
 	log.Printf("Received challenge request from %s", clientIP)
 
 	// Send challenge to client
 	challengeResp := &protocol.ChallengeResponse{
+		Algorithm:  byte(algo.ID()),
 		Difficulty: challenge.Difficulty,
 		Timestamp:  challenge.Timestamp,
 		RandomData: challenge.Data,
+		Token:      token,
 		ClientIP:   clientIP,
 	}
 	buf, err := protocol.EncodeChallengeResponse(challengeResp)
@@ -79,13 +127,13 @@ func (s *Server) handleChallengeResponse(conn net.Conn, challenge *pow.Challenge
 		Payload: buf,
 	}
 
-	err = protocol.WriteMessage(conn, msg)
+	err = enc.Encode(msg)
 	if err != nil {
 		return fmt.Errorf("failed to send challenge response to the client: %w", err)
 	}
 
 	// Read solution from client
-	msg, err = protocol.ReadMessage(conn)
+	msg, err = dec.Decode()
 	if err != nil {
 		return fmt.Errorf("failed to read solution: %w", err)
 	}
@@ -99,30 +147,69 @@ func (s *Server) handleChallengeResponse(conn net.Conn, challenge *pow.Challenge
 		return fmt.Errorf("failed to decode solution: %w", err)
 	}
 
+	// Reconstruct the challenge from the token the client echoed back,
+	// rather than trusting the in-memory challenge this connection's
+	// goroutine happens to still hold -- this is what makes the scheme
+	// stateless across a future multi-instance deployment.
+	verifiedChallenge, err := s.tokenSigner.VerifyToken(solution.Token, clientIP)
+	if err != nil {
+		s.sendError(conn, ErrorCodeInvalidSolution, "Invalid or expired challenge token")
+		return fmt.Errorf("invalid challenge token: %w", err)
+	}
+
+	if !s.tokenSigner.CheckAndMarkSolved(verifiedChallenge, solution.Nonces) {
+		s.sendError(conn, ErrorCodeInvalidSolution, "Challenge already solved")
+		return fmt.Errorf("replayed solution for challenge from %s", clientIP)
+	}
+
 	// Verify solution
-	if !pow.Verify(challenge, solution.Nonce, clientIP) {
+	if !algo.Verify(verifiedChallenge, pow.Solution{Nonces: solution.Nonces}, clientIP) {
 		s.sendError(conn, ErrorCodeInvalidSolution, "Invalid solution")
 		return fmt.Errorf("invalid PoW solution")
 	}
 
+	// A valid solution exists, so the encrypted channel's key (if
+	// requested) can now be derived; see protocol.DeriveEncryptionKey.
+	var encKey *[32]byte
+	if challengeReq.WantEncrypted {
+		var nonce uint64
+		if len(solution.Nonces) > 0 {
+			nonce = solution.Nonces[0]
+		}
+		key := protocol.DeriveEncryptionKey(verifiedChallenge.Data, nonce, clientIP)
+		encKey = &key
+	}
+
 	// Send quote or error
 	quote, err := s.quotes.GetRandom()
 	if err != nil {
-		s.sendError(conn, ErrorCodeInternalError, "No quotes available")
+		if encKey != nil {
+			s.sendEncryptedError(conn, ErrorCodeInternalError, "No quotes available", *encKey)
+		} else {
+			s.sendError(conn, ErrorCodeInternalError, "No quotes available")
+		}
 		return fmt.Errorf("failed to get quote: %w", err)
 	}
 
 	quoteMsg := &protocol.Quote{Text: quote}
-	payload, err := protocol.EncodeQuote(quoteMsg)
+
+	var payload []byte
+	msgType := protocol.MessageTypeQuote
+	if encKey != nil {
+		payload, err = protocol.EncodeQuoteEncrypted(quoteMsg, *encKey)
+		msgType = protocol.MessageTypeQuoteEncrypted
+	} else {
+		payload, err = protocol.EncodeQuote(quoteMsg)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to encode quote: %w", err)
 	}
 
 	msg = &protocol.Message{
-		Type:    protocol.MessageTypeQuote,
+		Type:    msgType,
 		Payload: payload,
 	}
 	conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
 
-	return protocol.WriteMessage(conn, msg)
+	return enc.Encode(msg)
 }
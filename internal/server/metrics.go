@@ -0,0 +1,29 @@
+package server
+
+import (
+	"expvar"
+	"sync/atomic"
+)
+
+// Metrics holds the worker-pool counters exposed over /debug/vars.
+type Metrics struct {
+	Accepted        atomic.Int64 // connections handed to a worker
+	RejectedFull    atomic.Int64 // connections rejected because the job queue was full
+	RejectedMaxConn atomic.Int64 // connections rejected because MaxConnections was reached
+	InFlight        atomic.Int64 // connections currently being handled by a worker
+}
+
+// NewMetrics creates an empty Metrics struct.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Publish registers the counters under expvar using the given prefix, e.g.
+// "pow_server_accepted". It is safe to call at most once per prefix; a
+// second call with the same prefix panics, matching expvar's own contract.
+func (m *Metrics) Publish(prefix string) {
+	expvar.Publish(prefix+"_accepted", expvar.Func(func() interface{} { return m.Accepted.Load() }))
+	expvar.Publish(prefix+"_rejected_full", expvar.Func(func() interface{} { return m.RejectedFull.Load() }))
+	expvar.Publish(prefix+"_rejected_maxconn", expvar.Func(func() interface{} { return m.RejectedMaxConn.Load() }))
+	expvar.Publish(prefix+"_in_flight", expvar.Func(func() interface{} { return m.InFlight.Load() }))
+}
@@ -1,29 +1,95 @@
 package server
 
 import (
+	"fmt"
+	"hash/fnv"
+	"math"
 	"sync"
 	"time"
 )
 
-// RateLimiter implements a sliding window rate limiter
+// RateLimiterMode selects how RateLimiter tracks per-IP request history.
+type RateLimiterMode int
+
+const (
+	// ModeTokenBucket is the default: O(1), allocation-free per-IP state
+	// refilled lazily on each Allow call, rather than a growing slice of
+	// timestamps. Tokens refill continuously at maxRequests/window per
+	// second, up to a burst of maxRequests.
+	ModeTokenBucket RateLimiterMode = iota
+	// ModeSlidingWindow keeps the original per-IP timestamp-slice
+	// behavior, for callers that need the exact "N requests in the last
+	// window" guarantee rather than a token-bucket approximation.
+	ModeSlidingWindow
+)
+
+// ParseRateLimiterMode maps a config string to a RateLimiterMode. "" and
+// "token-bucket" both map to ModeTokenBucket.
+func ParseRateLimiterMode(name string) (RateLimiterMode, error) {
+	switch name {
+	case "", "token-bucket":
+		return ModeTokenBucket, nil
+	case "sliding-window":
+		return ModeSlidingWindow, nil
+	default:
+		return 0, fmt.Errorf("unknown rate limiter mode: %q", name)
+	}
+}
+
+// rateLimiterShards is the number of independently-locked shards state is
+// spread across, keyed by fnv32(ip). Must be a power of two.
+const rateLimiterShards = 64
+
+// tokenBucketState is one IP's token-bucket state.
+type tokenBucketState struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// rateLimiterShard holds the per-IP state for one shard, guarded by its
+// own mutex so unrelated IPs never contend on the same lock.
+type rateLimiterShard struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucketState
+	windows map[string][]time.Time // only populated in ModeSlidingWindow
+}
+
+// RateLimiter rate-limits requests per client IP. State is sharded across
+// rateLimiterShards buckets so concurrent callers for different IPs don't
+// contend on a single mutex.
 type RateLimiter struct {
-	requests      map[string][]time.Time // IP -> timestamps of requests
-	mu            sync.RWMutex
-	maxRequests   int           // Maximum requests allowed
-	window        time.Duration // Time window
+	shards [rateLimiterShards]*rateLimiterShard
+	mode   RateLimiterMode
+
+	maxRequests int           // Maximum requests allowed per window
+	window      time.Duration // Time window
+
 	cleanupTicker *time.Ticker
 	cleanupStop   chan struct{}
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a token-bucket rate limiter: maxRequests is both
+// the bucket's burst size and the number of tokens that refill every
+// window.
 func NewRateLimiter(maxRequests int, window time.Duration, cleanupInterval time.Duration) *RateLimiter {
+	return NewRateLimiterWithMode(maxRequests, window, cleanupInterval, ModeTokenBucket)
+}
+
+// NewRateLimiterWithMode creates a rate limiter using the given mode.
+func NewRateLimiterWithMode(maxRequests int, window time.Duration, cleanupInterval time.Duration, mode RateLimiterMode) *RateLimiter {
 	rl := &RateLimiter{
-		requests:      make(map[string][]time.Time),
+		mode:          mode,
 		maxRequests:   maxRequests,
 		window:        window,
 		cleanupTicker: time.NewTicker(cleanupInterval),
 		cleanupStop:   make(chan struct{}),
 	}
+	for i := range rl.shards {
+		rl.shards[i] = &rateLimiterShard{
+			buckets: make(map[string]*tokenBucketState),
+			windows: make(map[string][]time.Time),
+		}
+	}
 
 	// Start background cleanup goroutine
 	go rl.cleanupLoop()
@@ -31,15 +97,60 @@ func NewRateLimiter(maxRequests int, window time.Duration, cleanupInterval time.
 	return rl
 }
 
+// shardFor returns the shard responsible for ip.
+func (rl *RateLimiter) shardFor(ip string) *rateLimiterShard {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return rl.shards[h.Sum32()&(rateLimiterShards-1)]
+}
+
 // Allow checks if a request from the given IP should be allowed
 func (rl *RateLimiter) Allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+	if rl.mode == ModeSlidingWindow {
+		return rl.allowSlidingWindow(ip)
+	}
+	return rl.allowTokenBucket(ip)
+}
+
+func (rl *RateLimiter) allowTokenBucket(ip string) bool {
+	shard := rl.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
 
 	now := time.Now()
-	timestamps := rl.requests[ip]
+	b, ok := shard.buckets[ip]
+	if !ok {
+		b = &tokenBucketState{tokens: float64(rl.maxRequests), lastRefill: now}
+		shard.buckets[ip] = b
+	} else {
+		rl.refillLocked(b, now)
+	}
 
-	valid := make([]time.Time, 0)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refillLocked adds tokens accrued since b.lastRefill, capped at the
+// bucket's burst size. Callers must hold the owning shard's mutex.
+func (rl *RateLimiter) refillLocked(b *tokenBucketState, now time.Time) {
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	refillRate := float64(rl.maxRequests) / rl.window.Seconds()
+	b.tokens = math.Min(float64(rl.maxRequests), b.tokens+elapsed*refillRate)
+	b.lastRefill = now
+}
+
+func (rl *RateLimiter) allowSlidingWindow(ip string) bool {
+	shard := rl.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := time.Now()
+	timestamps := shard.windows[ip]
+
+	valid := make([]time.Time, 0, len(timestamps))
 	for _, t := range timestamps {
 		if now.Sub(t) <= rl.window {
 			valid = append(valid, t)
@@ -47,16 +158,51 @@ func (rl *RateLimiter) Allow(ip string) bool {
 	}
 
 	if len(valid) >= rl.maxRequests {
+		shard.windows[ip] = valid
 		return false
 	}
 
 	valid = append(valid, now)
-	rl.requests[ip] = valid
+	shard.windows[ip] = valid
 
 	return true
 }
 
-// cleanupLoop periodically removes old entries from the map
+// RecentCount returns a measure of how much of ip's recent quota has been
+// consumed, without consuming a slot itself. It is used by the difficulty
+// controller to penalize noisy clients. In ModeSlidingWindow this is the
+// exact count of requests within the window; in ModeTokenBucket it's the
+// number of tokens currently spent from the burst allowance.
+func (rl *RateLimiter) RecentCount(ip string) int {
+	shard := rl.shardFor(ip)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	now := time.Now()
+
+	if rl.mode == ModeSlidingWindow {
+		count := 0
+		for _, t := range shard.windows[ip] {
+			if now.Sub(t) <= rl.window {
+				count++
+			}
+		}
+		return count
+	}
+
+	b, ok := shard.buckets[ip]
+	if !ok {
+		return 0
+	}
+	rl.refillLocked(b, now)
+	spent := float64(rl.maxRequests) - b.tokens
+	if spent < 0 {
+		return 0
+	}
+	return int(math.Round(spent))
+}
+
+// cleanupLoop periodically removes stale per-IP entries from every shard
 func (rl *RateLimiter) cleanupLoop() {
 	for {
 		select {
@@ -68,27 +214,35 @@ func (rl *RateLimiter) cleanupLoop() {
 	}
 }
 
-// cleanup removes IPs with no recent requests
+// cleanup removes IPs with no recent activity, one shard at a time so a
+// cleanup pass never blocks every shard's hot path at once.
 func (rl *RateLimiter) cleanup() {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
 	now := time.Now()
-	for ip, timestamps := range rl.requests {
-		// Remove timestamps older than window
-		valid := make([]time.Time, 0)
-		for _, t := range timestamps {
-			if now.Sub(t) <= rl.window {
-				valid = append(valid, t)
+
+	for _, shard := range rl.shards {
+		shard.mu.Lock()
+
+		for ip, b := range shard.buckets {
+			if now.Sub(b.lastRefill) > rl.window {
+				delete(shard.buckets, ip)
 			}
 		}
 
-		// If no valid timestamps, remove IP from map
-		if len(valid) == 0 {
-			delete(rl.requests, ip)
-		} else {
-			rl.requests[ip] = valid
+		for ip, timestamps := range shard.windows {
+			valid := make([]time.Time, 0)
+			for _, t := range timestamps {
+				if now.Sub(t) <= rl.window {
+					valid = append(valid, t)
+				}
+			}
+			if len(valid) == 0 {
+				delete(shard.windows, ip)
+			} else {
+				shard.windows[ip] = valid
+			}
 		}
+
+		shard.mu.Unlock()
 	}
 }
 
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -68,8 +69,11 @@ func TestRateLimiter_MultipleIPs(t *testing.T) {
 }
 
 func TestRateLimiter_SlidingWindow(t *testing.T) {
-	// Config: 3 requests per 2 seconds
-	rl := NewRateLimiter(3, 2*time.Second, time.Minute)
+	// Config: 3 requests per 2 seconds. ModeSlidingWindow is requested
+	// explicitly here because the assertions below rely on the exact "N
+	// requests in the last window" guarantee, which ModeTokenBucket (the
+	// default) only approximates via continuous refill.
+	rl := NewRateLimiterWithMode(3, 2*time.Second, time.Minute, ModeSlidingWindow)
 	defer rl.Stop()
 
 	ip := "192.168.1.1"
@@ -102,3 +106,74 @@ func TestRateLimiter_SlidingWindow(t *testing.T) {
 		t.Error("Request at t=2.1s should be allowed")
 	}
 }
+
+func TestRateLimiter_TokenBucket_RefillsOverTime(t *testing.T) {
+	// Config: 2 tokens burst, refilling over 200ms
+	rl := NewRateLimiter(2, 200*time.Millisecond, time.Minute)
+	defer rl.Stop()
+
+	ip := "192.168.1.1"
+
+	if !rl.Allow(ip) || !rl.Allow(ip) {
+		t.Fatal("first 2 requests should exhaust the burst")
+	}
+	if rl.Allow(ip) {
+		t.Error("3rd request should be blocked with an empty bucket")
+	}
+
+	time.Sleep(250 * time.Millisecond)
+
+	if !rl.Allow(ip) {
+		t.Error("request after a full refill interval should be allowed")
+	}
+}
+
+func TestRateLimiter_RecentCount_TokenBucket(t *testing.T) {
+	rl := NewRateLimiter(4, time.Second, time.Minute)
+	defer rl.Stop()
+
+	ip := "192.168.1.1"
+
+	if got := rl.RecentCount(ip); got != 0 {
+		t.Fatalf("RecentCount for an unseen IP = %d, want 0", got)
+	}
+
+	rl.Allow(ip)
+	rl.Allow(ip)
+
+	if got := rl.RecentCount(ip); got != 2 {
+		t.Errorf("RecentCount after 2 requests = %d, want 2", got)
+	}
+}
+
+func TestRateLimiter_ShardsAreIndependent(t *testing.T) {
+	rl := NewRateLimiter(1000, time.Second, time.Minute)
+	defer rl.Stop()
+
+	// IPs that land in different shards shouldn't contend or leak state
+	// into one another.
+	for i := 0; i < rateLimiterShards*4; i++ {
+		ip := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		if !rl.Allow(ip) {
+			t.Fatalf("Allow(%q) unexpectedly blocked", ip)
+		}
+	}
+}
+
+func BenchmarkRateLimiter_Allow(b *testing.B) {
+	rl := NewRateLimiter(1_000_000, time.Second, time.Minute)
+	defer rl.Stop()
+
+	const numIPs = 10_000
+	ips := make([]string, numIPs)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("10.%d.%d.%d", i/65536, (i/256)%256, i%256)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rl.Allow(ips[i%numIPs])
+	}
+}
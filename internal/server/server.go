@@ -1,9 +1,12 @@
 package server
 
 import (
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,12 +16,20 @@ import (
 
 // Server represents the TCP server
 type Server struct {
-	listener     net.Listener
-	config       *Config
-	quotes       *quotes.Manager
-	rateLimiter  *RateLimiter
-	activeConns  atomic.Int32
-	shutdownChan chan struct{}
+	listener             net.Listener
+	config               *Config
+	quotes               *quotes.Manager
+	rateLimiter          *RateLimiter
+	difficultyController *pow.DifficultyController
+	algorithm            pow.Algorithm
+	tokenSigner          *pow.TokenSigner
+	metrics              *Metrics
+	activeConns          atomic.Int32
+	shutdownChan         chan struct{}
+	acceptDone           chan struct{}
+	jobChan              chan net.Conn
+	workers              sync.WaitGroup
+	adminServer          *http.Server
 }
 
 // Config holds server configuration
@@ -30,17 +41,120 @@ type Config struct {
 	WriteTimeout       time.Duration
 	ConnectionTimeout  time.Duration
 	PoWDifficulty      int
+	PoWMaxDifficulty   int
 	PoWChallengeMaxAge time.Duration
+
+	// Workers is the number of goroutines pulled from a fixed pool that
+	// handle accepted connections. Defaults to MaxConnections if zero.
+	Workers int
+	// QueueSize bounds the number of accepted connections waiting for a
+	// free worker. Once full, new connections are rejected immediately
+	// with ErrorCodeServerBusy. Defaults to Workers if zero.
+	QueueSize int
+	// AdminAddr, if set, serves expvar metrics (accepted, rejected-full,
+	// rejected-maxconn, in-flight) over HTTP on /debug/vars.
+	AdminAddr string
+
+	// PoWAlgorithm selects the PoW scheme handed out to clients. Defaults
+	// to pow.AlgorithmHashcashSHA256 if zero.
+	PoWAlgorithm pow.AlgorithmID
+
+	// DynamicDifficulty enables the EWMA-based difficulty controller. When
+	// false the server always hands out PoWDifficulty.
+	DynamicDifficulty bool
+	// DifficultyTargetRate is the accepts/second EWMA beyond which the
+	// controller starts raising difficulty above the base. Defaults to 10
+	// if zero.
+	DifficultyTargetRate float64
+	// DifficultyHalfLife controls how quickly the load EWMA forgets past
+	// accepts. Defaults to 5s if zero.
+	DifficultyHalfLife time.Duration
+
+	// HMACKey signs the stateless challenge tokens handed out in
+	// ChallengeResponse (see pow.TokenSigner). If empty, NewServer
+	// generates a random ephemeral key, which means tokens won't verify
+	// across a process restart -- set this explicitly for multi-instance
+	// deployments behind a load balancer.
+	HMACKey []byte
+	// HMACMaxPreviousKeys controls how many rotated-out HMAC keys remain
+	// acceptable, giving in-flight tokens an overlap window across a
+	// RotateHMACKey call. Defaults to 1 if zero.
+	HMACMaxPreviousKeys int
 }
 
 // NewServer creates a new TCP server
 func NewServer(config *Config, quotesManager *quotes.Manager, rateLimiter *RateLimiter) *Server {
-	return &Server{
+	workers := config.Workers
+	if workers <= 0 {
+		workers = config.MaxConnections
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = workers
+	}
+
+	s := &Server{
 		config:       config,
 		quotes:       quotesManager,
 		rateLimiter:  rateLimiter,
+		metrics:      NewMetrics(),
 		shutdownChan: make(chan struct{}),
+		acceptDone:   make(chan struct{}),
+		jobChan:      make(chan net.Conn, queueSize),
+	}
+
+	algoID := config.PoWAlgorithm
+	if algoID == 0 {
+		algoID = pow.AlgorithmHashcashSHA256
+	}
+	algo, err := pow.ByID(algoID)
+	if err != nil {
+		log.Printf("Unknown PoW algorithm %v, falling back to hashcash-sha256", algoID)
+		algo = pow.HashcashSHA256{}
+	}
+	s.algorithm = algo
+
+	if config.DynamicDifficulty {
+		targetRate := config.DifficultyTargetRate
+		if targetRate <= 0 {
+			targetRate = 10
+		}
+		halfLife := config.DifficultyHalfLife
+		if halfLife <= 0 {
+			halfLife = 5 * time.Second
+		}
+		maxDifficulty := config.PoWMaxDifficulty
+		if maxDifficulty < config.PoWDifficulty {
+			maxDifficulty = config.PoWDifficulty
+		}
+		s.difficultyController = pow.NewDifficultyController(config.PoWDifficulty, maxDifficulty, targetRate, halfLife)
+	}
+
+	hmacKey := config.HMACKey
+	if len(hmacKey) == 0 {
+		hmacKey = make([]byte, 32)
+		if _, err := rand.Read(hmacKey); err != nil {
+			log.Fatalf("Failed to generate ephemeral HMAC key: %v", err)
+		}
+		log.Printf("No HMAC key configured, generated an ephemeral one; tokens won't verify across a restart")
+	}
+	maxPreviousKeys := config.HMACMaxPreviousKeys
+	if maxPreviousKeys <= 0 {
+		maxPreviousKeys = 1
+	}
+	maxAge := config.PoWChallengeMaxAge
+	if maxAge <= 0 {
+		maxAge = time.Minute
 	}
+	s.tokenSigner = pow.NewTokenSigner(hmacKey, maxAge, maxPreviousKeys)
+
+	return s
+}
+
+// RotateHMACKey rotates the signing key used for challenge tokens, keeping
+// the previous key acceptable during the configured overlap window.
+func (s *Server) RotateHMACKey(newKey []byte) {
+	s.tokenSigner.RotateKey(newKey)
 }
 
 // Start starts the TCP server
@@ -55,14 +169,54 @@ func (s *Server) Start() error {
 	s.listener = listener
 	log.Printf("Server listening on %s", addr)
 
+	workers := s.config.Workers
+	if workers <= 0 {
+		workers = s.config.MaxConnections
+	}
+	for i := 0; i < workers; i++ {
+		s.workers.Add(1)
+		go s.worker()
+	}
+
+	if s.config.AdminAddr != "" {
+		s.metrics.Publish("pow_server")
+		adminListener, err := net.Listen("tcp", s.config.AdminAddr)
+		if err != nil {
+			return fmt.Errorf("failed to start admin listener: %w", err)
+		}
+		s.adminServer = &http.Server{Handler: http.DefaultServeMux}
+		go func() {
+			if err := s.adminServer.Serve(adminListener); err != nil && err != http.ErrServerClosed {
+				log.Printf("Admin server error: %v", err)
+			}
+		}()
+		log.Printf("Admin metrics listening on %s", s.config.AdminAddr)
+	}
+
 	// Accept connections
 	go s.acceptLoop()
 
 	return nil
 }
 
-// acceptLoop accepts incoming connections
+// worker pulls accepted connections off jobChan and handles them until the
+// channel is closed during shutdown, draining whatever is still queued.
+func (s *Server) worker() {
+	defer s.workers.Done()
+
+	for conn := range s.jobChan {
+		s.metrics.InFlight.Add(1)
+		s.handleConnection(conn)
+		s.metrics.InFlight.Add(-1)
+		s.activeConns.Add(-1)
+	}
+}
+
+// acceptLoop accepts incoming connections and hands them to the worker
+// pool, rejecting with backpressure when the pool or its queue is full.
 func (s *Server) acceptLoop() {
+	defer close(s.acceptDone)
+
 	for {
 		select {
 		case <-s.shutdownChan:
@@ -81,25 +235,54 @@ func (s *Server) acceptLoop() {
 			}
 		}
 
-		// Check max connections
-		current := s.activeConns.Load()
-		if current >= int32(s.config.MaxConnections) {
-			log.Printf("Max connections reached, rejecting %s", conn.RemoteAddr())
-			conn.Close()
-			continue
-		}
+		s.acceptConn(conn)
+	}
+}
 
+// acceptConn applies the max-connections gate and then hands conn to the
+// worker pool via a non-blocking send, rejecting immediately if the pool's
+// queue is saturated. Split out from acceptLoop so it can be exercised
+// directly in tests without a real listener.
+func (s *Server) acceptConn(conn net.Conn) {
+	current := s.activeConns.Load()
+	if current >= int32(s.config.MaxConnections) {
+		log.Printf("Max connections reached, rejecting %s", conn.RemoteAddr())
+		s.metrics.RejectedMaxConn.Add(1)
+		s.rejectConn(conn, "Max connections reached")
+		return
+	}
+
+	select {
+	case s.jobChan <- conn:
 		s.activeConns.Add(1)
-		go s.handleConnection(conn)
+		s.metrics.Accepted.Add(1)
+		if s.difficultyController != nil {
+			s.difficultyController.RecordAccept()
+		}
+	default:
+		log.Printf("Job queue full, rejecting %s", conn.RemoteAddr())
+		s.metrics.RejectedFull.Add(1)
+		s.rejectConn(conn, "Server busy")
 	}
 }
 
+// rejectConn sends a busy error and closes conn off the accept-loop
+// goroutine. sendError's write is bounded by WriteTimeout, but that's still
+// enough for a slow or non-reading client to stall every new accept for the
+// duration of the timeout if done inline -- exactly the overload the worker
+// pool exists to survive. Running it in its own goroutine keeps acceptLoop
+// free to keep accepting (and rejecting) regardless of how long this one
+// write takes.
+func (s *Server) rejectConn(conn net.Conn, message string) {
+	go func() {
+		defer conn.Close()
+		s.sendError(conn, ErrorCodeServerBusy, message)
+	}()
+}
+
 // handleConnection handles a single client connection
 func (s *Server) handleConnection(conn net.Conn) {
-	defer func() {
-		conn.Close()
-		s.activeConns.Add(-1)
-	}()
+	defer conn.Close()
 
 	// Set overall connection timeout
 	deadline := time.Now().Add(s.config.ConnectionTimeout)
@@ -116,7 +299,11 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 
 	// Generate PoW challenge
-	challenge, err := pow.GenerateChallenge(clientIP, s.config.PoWDifficulty)
+	difficulty := s.config.PoWDifficulty
+	if s.difficultyController != nil {
+		difficulty = s.difficultyController.Difficulty(s.rateLimiter.RecentCount(clientIP))
+	}
+	challenge, token, err := s.tokenSigner.Issue(clientIP, difficulty)
 	if err != nil {
 		log.Printf("Failed to generate challenge: %v", err)
 		s.sendError(conn, ErrorCodeInternalError, "Internal error")
@@ -124,7 +311,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 	}
 
 	// Handle challenge-response protocol
-	if err := s.handleChallengeResponse(conn, challenge); err != nil {
+	if err := s.handleChallengeResponse(conn, challenge, token, s.algorithm); err != nil {
 		log.Printf("Challenge-response failed for %s: %v", clientIP, err)
 		return
 	}
@@ -132,13 +319,24 @@ func (s *Server) handleConnection(conn net.Conn) {
 	log.Printf("Connection from %s completed successfully", clientIP)
 }
 
-// Stop gracefully stops the server
+// Stop gracefully stops the server: it stops accepting new connections,
+// then drains in-flight and already-queued jobs before returning.
 func (s *Server) Stop() error {
 	close(s.shutdownChan)
 
+	var err error
 	if s.listener != nil {
-		return s.listener.Close()
+		err = s.listener.Close()
 	}
 
-	return nil
+	<-s.acceptDone
+	close(s.jobChan)
+	s.workers.Wait()
+	s.tokenSigner.Stop()
+
+	if s.adminServer != nil {
+		s.adminServer.Close()
+	}
+
+	return err
 }
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kerimovkk/pow-server/internal/protocol"
+	"github.com/kerimovkk/pow-server/internal/quotes"
+)
+
+func newTestServer(t *testing.T, cfg *Config) *Server {
+	t.Helper()
+
+	rl := NewRateLimiter(1000, time.Minute, time.Minute)
+	t.Cleanup(rl.Stop)
+
+	return NewServer(cfg, quotes.NewManager(), rl)
+}
+
+func TestServer_AcceptConn_RejectsWhenQueueFull(t *testing.T) {
+	cfg := &Config{
+		MaxConnections: 100,
+		Workers:        1,
+		QueueSize:      1,
+		WriteTimeout:   time.Second,
+	}
+	s := newTestServer(t, cfg)
+
+	// No workers running, so the first accepted conn sits in the queue
+	// and the second one must be rejected for lack of room.
+	client1, server1 := net.Pipe()
+	defer client1.Close()
+	defer server1.Close()
+	s.acceptConn(server1)
+
+	if got := s.metrics.Accepted.Load(); got != 1 {
+		t.Fatalf("Accepted = %d, want 1", got)
+	}
+
+	client2, server2 := net.Pipe()
+	defer client2.Close()
+	defer server2.Close()
+	s.acceptConn(server2)
+
+	if got := s.metrics.RejectedFull.Load(); got != 1 {
+		t.Fatalf("RejectedFull = %d, want 1", got)
+	}
+
+	client2.SetReadDeadline(time.Now().Add(time.Second))
+	msg, err := protocol.ReadMessage(client2)
+	if err != nil {
+		t.Fatalf("expected a busy error on the rejected conn, got err: %v", err)
+	}
+	if msg.Type != protocol.MessageTypeError {
+		t.Fatalf("expected MessageTypeError, got %d", msg.Type)
+	}
+	errMsg, err := protocol.DecodeError(msg.Payload)
+	if err != nil {
+		t.Fatalf("DecodeError failed: %v", err)
+	}
+	if errMsg.Code != protocol.ErrorCodeServerBusy {
+		t.Errorf("Code = %d, want ErrorCodeServerBusy (%d)", errMsg.Code, protocol.ErrorCodeServerBusy)
+	}
+}
+
+func TestServer_AcceptConn_RejectsWhenMaxConnectionsReached(t *testing.T) {
+	cfg := &Config{
+		MaxConnections: 0,
+		Workers:        1,
+		QueueSize:      1,
+		WriteTimeout:   50 * time.Millisecond,
+	}
+	s := newTestServer(t, cfg)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	s.acceptConn(server)
+
+	if got := s.metrics.RejectedMaxConn.Load(); got != 1 {
+		t.Fatalf("RejectedMaxConn = %d, want 1", got)
+	}
+	if got := s.metrics.Accepted.Load(); got != 0 {
+		t.Fatalf("Accepted = %d, want 0", got)
+	}
+}
+
+func TestServer_Worker_DrainsQueueOnStop(t *testing.T) {
+	cfg := &Config{
+		MaxConnections: 100,
+		Workers:        2,
+		QueueSize:      4,
+		ReadTimeout:    time.Second,
+		WriteTimeout:   time.Second,
+	}
+	s := newTestServer(t, cfg)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s.listener = listener
+
+	for i := 0; i < 2; i++ {
+		s.workers.Add(1)
+		go s.worker()
+	}
+	go s.acceptLoop()
+
+	// Drive a couple of real connections through the pool; handleConnection
+	// will fail fast (each client closes without sending a challenge
+	// request) but that's enough to exercise the
+	// accept -> queue -> worker -> activeConns-- path.
+	for i := 0; i < 2; i++ {
+		conn, err := net.DialTimeout("tcp", listener.Addr().String(), time.Second)
+		if err != nil {
+			t.Fatalf("dial failed: %v", err)
+		}
+		conn.Close()
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop() failed: %v", err)
+	}
+
+	if got := s.activeConns.Load(); got != 0 {
+		t.Errorf("activeConns after Stop() = %d, want 0", got)
+	}
+}